@@ -0,0 +1,208 @@
+package pg
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// DefaultStmtCacheSize 每个客户端, 每个事务默认缓存的预处理语句个数
+const DefaultStmtCacheSize = 64
+
+// stmtEntry 缓存的预处理语句
+type stmtEntry struct {
+	query   string    // SQL
+	stmt    *sql.Stmt // 预处理语句
+	refs    int       // 正在使用该语句的个数
+	evicted bool      // 已被淘汰, 不再使用时关闭
+}
+
+// stmtCache 以SQL为键的 LRU 预处理语句缓存
+type stmtCache struct {
+	mu      sync.Mutex
+	size    int                      // 最多缓存的语句个数
+	list    *list.List               // 最近使用的在前
+	entries map[string]*list.Element // SQL => *stmtEntry
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:    size,
+		list:    list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// acquire 获取缓存的预处理语句, 不存在时使用 prepare 创建; 使用完毕后必须调用 release
+func (c *stmtCache) acquire(ctx context.Context, query string, prepare func(ctx context.Context, query string) (*sql.Stmt, error)) (*stmtEntry, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[query]; ok {
+		c.list.MoveToFront(el)
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		c.mu.Unlock()
+		return e, nil
+	}
+	c.mu.Unlock()
+	stmt, err := prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[query]; ok {
+		// 其他协程已经缓存了同样的语句
+		stmt.Close()
+		c.list.MoveToFront(el)
+		e := el.Value.(*stmtEntry)
+		e.refs++
+		return e, nil
+	}
+	e := &stmtEntry{query: query, stmt: stmt, refs: 1}
+	c.entries[query] = c.list.PushFront(e)
+	for c.list.Len() > c.size {
+		c.evict(c.list.Back())
+	}
+	return e, nil
+}
+
+// release 归还预处理语句, 已被淘汰的语句在没有使用者时关闭
+func (c *stmtCache) release(e *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.refs--
+	if e.evicted && e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// evict 淘汰一个语句
+func (c *stmtCache) evict(el *list.Element) {
+	e := el.Value.(*stmtEntry)
+	c.list.Remove(el)
+	delete(c.entries, e.query)
+	e.evicted = true
+	if e.refs == 0 {
+		e.stmt.Close()
+	}
+}
+
+// close 淘汰所有缓存的语句
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.list.Len() > 0 {
+		c.evict(c.list.Back())
+	}
+}
+
+// SetStmtCacheSize 设置默认客户端缓存的预处理语句个数, 小于等于 0 时不缓存
+func SetStmtCacheSize(size int) {
+	defaultClient.SetStmtCacheSize(size)
+}
+
+// SetStmtCacheSize 设置客户端及其事务缓存的预处理语句个数, 小于等于 0 时不缓存
+func (c *Client) SetStmtCacheSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stmts != nil {
+		c.stmts.close()
+		c.stmts = nil
+	}
+	if size <= 0 {
+		size = -1
+	}
+	c.size = size
+}
+
+// stmtCacheSize 客户端缓存的预处理语句个数, 未设置时使用默认值
+func (c *Client) stmtCacheSize() int {
+	if c.size == 0 {
+		return DefaultStmtCacheSize
+	}
+	return c.size
+}
+
+// cache 客户端当前数据库连接的语句缓存, 数据库连接变更时重建缓存
+func (c *Client) cache() *stmtCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := c.stmtCacheSize()
+	if size <= 0 {
+		return nil
+	}
+	db := c.DB()
+	if c.stmts != nil && c.stmtsDB != db {
+		c.stmts.close()
+		c.stmts = nil
+	}
+	if c.stmts == nil {
+		c.stmts = newStmtCache(size)
+		c.stmtsDB = db
+	}
+	return c.stmts
+}
+
+// cache 当前构造器使用的语句缓存, 事务中使用该事务的缓存
+func (x *Curd) cache() *stmtCache {
+	if x.tx != nil {
+		return x.stmts
+	}
+	if x.client == nil {
+		return defaultClient.cache()
+	}
+	return x.client.cache()
+}
+
+// prepared 获取缓存的预处理语句, 未开启缓存时返回 nil
+func (x *Curd) prepared(ctx context.Context, query string) (*sql.Stmt, func(), error) {
+	cache := x.cache()
+	if cache == nil {
+		return nil, func() {}, nil
+	}
+	e, err := cache.acquire(ctx, query, x.conn().PrepareContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e.stmt, func() { cache.release(e) }, nil
+}
+
+// execContext 执行不返回结果集的SQL, 优先使用缓存的预处理语句
+func (x *Curd) execContext(ctx context.Context, query string, args []interface{}) (sql.Result, error) {
+	stmt, release, err := x.prepared(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return x.conn().ExecContext(ctx, query, args...)
+}
+
+// queryContext 执行返回结果集的SQL, 优先使用缓存的预处理语句
+func (x *Curd) queryContext(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
+	stmt, release, err := x.prepared(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return x.conn().QueryContext(ctx, query, args...)
+}
+
+// queryRowContext 执行最多返回一行的SQL, 优先使用缓存的预处理语句
+func (x *Curd) queryRowContext(ctx context.Context, query string, args []interface{}) (*sql.Row, error) {
+	stmt, release, err := x.prepared(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if stmt != nil {
+		return stmt.QueryRowContext(ctx, args...), nil
+	}
+	return x.conn().QueryRowContext(ctx, query, args...), nil
+}
@@ -0,0 +1,103 @@
+package pg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestStmtCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	db, d := testDB(t.Name())
+	cache := newStmtCache(2)
+	ctx := context.Background()
+	use := func(query string) {
+		e, err := cache.acquire(ctx, query, db.PrepareContext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache.release(e)
+	}
+	use("a")
+	use("b")
+	use("a") // b 成为最久未使用的语句
+	use("c")
+	if !reflect.DeepEqual(d.closed, []string{"b"}) {
+		t.Fatalf("closed %v, want [b]", d.closed)
+	}
+	use("d")
+	if !reflect.DeepEqual(d.closed, []string{"b", "a"}) {
+		t.Fatalf("closed %v, want [b a]", d.closed)
+	}
+	use("c")
+	if !reflect.DeepEqual(d.prepared, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("prepared %v, want [a b c d]", d.prepared)
+	}
+	cache.close()
+	if len(d.closed) != 4 {
+		t.Fatalf("closed %v after close, want all 4", d.closed)
+	}
+}
+
+func TestStmtCacheKeepsEvictedStmtInUse(t *testing.T) {
+	db, d := testDB(t.Name())
+	cache := newStmtCache(1)
+	ctx := context.Background()
+	a, err := cache.acquire(ctx, "a", db.PrepareContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cache.acquire(ctx, "b", db.PrepareContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.evicted || len(d.closed) != 0 {
+		t.Fatalf("a evicted %v, closed %v; want evicted and still open", a.evicted, d.closed)
+	}
+	// 淘汰之后再次获取会重新预处理
+	again, err := cache.acquire(ctx, "a", db.PrepareContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == a {
+		t.Fatal("acquired the evicted entry again")
+	}
+	cache.release(a)
+	if !reflect.DeepEqual(d.closed, []string{"a"}) {
+		t.Fatalf("closed %v, want [a]", d.closed)
+	}
+	// b 被 again 淘汰, 但仍在使用
+	cache.release(b)
+	if !reflect.DeepEqual(d.closed, []string{"a", "b"}) {
+		t.Fatalf("closed %v, want [a b]", d.closed)
+	}
+	cache.release(again)
+	if len(d.closed) != 2 {
+		t.Fatalf("closed %v, the cached entry must stay open", d.closed)
+	}
+}
+
+func TestSetStmtCacheSizeDisables(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	c.Table("user").WhereEqual("id", 1).Del()
+	c.Table("user").WhereEqual("id", 1).Del()
+	if len(d.prepared) != 1 || len(d.closed) != 0 {
+		t.Fatalf("cached: prepared %v, closed %v", d.prepared, d.closed)
+	}
+	for _, size := range []int{0, -1} {
+		c.SetStmtCacheSize(size)
+		if c.cache() != nil {
+			t.Fatalf("size %d: cache is still enabled", size)
+		}
+		d.prepared, d.closed = nil, nil
+		c.Table("user").WhereEqual("id", 1).Del()
+		c.Table("user").WhereEqual("id", 1).Del()
+		// 不缓存时每次执行都重新预处理并关闭
+		if len(d.prepared) != 2 || len(d.closed) != 2 {
+			t.Fatalf("size %d: prepared %v, closed %v", size, d.prepared, d.closed)
+		}
+	}
+	if tx := c.Begin(); tx.stmts != nil {
+		t.Fatal("transaction cache is still enabled")
+	}
+}
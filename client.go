@@ -0,0 +1,65 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Client 持有独立的数据库连接, 一个程序可以同时操作多个数据库
+type Client struct {
+	db     *sql.DB           // 数据库连接, 为 nil 时使用包变量 DB
+	logger Logger            // 客户端日志, 优先于全局日志
+	hooks  []Hook            // 客户端钩子, 在全局钩子之后执行
+	slow   *SlowQueryOptions // 客户端慢查询配置, 优先于全局配置
+	retry  *RetryPolicy      // 客户端事务重试策略, 优先于全局策略
+
+	mu      sync.Mutex
+	size    int        // 缓存的预处理语句个数, 0 为默认值, 小于 0 不缓存
+	stmts   *stmtCache // 预处理语句缓存
+	stmtsDB *sql.DB    // 预处理语句缓存所属的数据库连接
+}
+
+// defaultClient 包级别函数 Table, Begin 使用的默认客户端
+var defaultClient = &Client{}
+
+// NewClient 使用指定的数据库连接创建客户端
+func NewClient(db *sql.DB) *Client {
+	return &Client{db: db}
+}
+
+// DB 客户端使用的数据库连接
+func (c *Client) DB() *sql.DB {
+	if c.db != nil {
+		return c.db
+	}
+	return DB
+}
+
+func (c *Client) Table(table interface{}) *Curd {
+	x := &Curd{}
+	x.client = c
+	x.table, x.space = tabled(table)
+	return x
+}
+
+func (c *Client) Begin() *Curd {
+	return c.BeginCtx(context.Background(), nil)
+}
+
+// BeginCtx 开启事务, ctx 被取消时 database/sql 会自动回滚该事务
+func (c *Client) BeginCtx(ctx context.Context, opts *sql.TxOptions) *Curd {
+	x := &Curd{}
+	x.client = c
+	x.ctx = ctx
+	tx, err := c.DB().BeginTx(ctx, opts)
+	if err != nil {
+		x.error = err
+		return x
+	}
+	x.tx = tx
+	if size := c.stmtCacheSize(); size > 0 {
+		x.stmts = newStmtCache(size)
+	}
+	return x
+}
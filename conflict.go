@@ -0,0 +1,217 @@
+package pg
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// conflict INSERT ... ON CONFLICT 子句信息
+type conflict struct {
+	target  string        // 冲突目标 ( "col1", "col2" ) 或 ON CONSTRAINT "name"
+	columns []string      // 冲突目标列名
+	nothing bool          // DO NOTHING
+	update  []string      // DO UPDATE SET 更新的列, 为空时更新除冲突目标和主键之外的所有插入列
+	where   string        // DO UPDATE ... WHERE 条件
+	args    []interface{} // WHERE 条件参数
+}
+
+func (x *Curd) upsert() *conflict {
+	if x.conflict == nil {
+		x.conflict = &conflict{}
+	}
+	return x.conflict
+}
+
+// OnConflict ON CONFLICT ( cols )
+func (x *Curd) OnConflict(cols ...string) *Curd {
+	c := x.upsert()
+	c.columns = cols
+	c.target = ""
+	for _, v := range cols {
+		if c.target == "" {
+			c.target = escaped(v)
+		} else {
+			c.target = fmt.Sprintf("%s, %s", c.target, escaped(v))
+		}
+	}
+	if c.target != "" {
+		c.target = fmt.Sprintf("( %s )", c.target)
+	}
+	return x
+}
+
+// OnConstraint ON CONFLICT ON CONSTRAINT name
+func (x *Curd) OnConstraint(name string) *Curd {
+	c := x.upsert()
+	c.columns = nil
+	c.target = fmt.Sprintf("ON CONSTRAINT %s", escaped(name))
+	return x
+}
+
+// DoNothing 冲突时忽略插入
+func (x *Curd) DoNothing() *Curd {
+	c := x.upsert()
+	c.nothing = true
+	c.update = nil
+	return x
+}
+
+// DoUpdate 冲突时使用 EXCLUDED.col 更新指定的列, 不指定列时更新除冲突目标和主键之外的所有插入列
+func (x *Curd) DoUpdate(cols ...string) *Curd {
+	c := x.upsert()
+	c.nothing = false
+	c.update = cols
+	return x
+}
+
+// ConflictWhere DO UPDATE 的 WHERE 条件, 占位符从 $1 开始编号
+func (x *Curd) ConflictWhere(where string, args ...interface{}) *Curd {
+	c := x.upsert()
+	c.where = where
+	c.args = args
+	return x
+}
+
+// valid 检查 ON CONFLICT 子句, DO UPDATE 必须指定冲突目标
+func (c *conflict) valid() error {
+	if c != nil && c.target == "" && !c.nothing {
+		return ErrConflictTarget
+	}
+	return nil
+}
+
+// clause 生成 ON CONFLICT 子句, columns 为插入的列名, index 为插入语句已使用的占位符个数
+// skip 为不能自动更新的列(主键, 使用 DEFAULT 插入的列), DoUpdate 没有指定列时不会出现在 SET 中
+func (c *conflict) clause(columns []string, skip []string, index int) (string, []interface{}) {
+	clause := "ON CONFLICT"
+	if c.target != "" {
+		clause = fmt.Sprintf("%s %s", clause, c.target)
+	}
+	if c.nothing {
+		return fmt.Sprintf("%s DO NOTHING", clause), nil
+	}
+	update := c.update
+	if len(update) == 0 {
+		skipped := map[string]bool{}
+		for _, v := range c.columns {
+			skipped[v] = true
+		}
+		for _, v := range skip {
+			skipped[v] = true
+		}
+		for _, v := range columns {
+			if !skipped[v] {
+				update = append(update, v)
+			}
+		}
+	}
+	set := ""
+	for _, v := range update {
+		if set == "" {
+			set = fmt.Sprintf("%s = EXCLUDED.%s", escaped(v), escaped(v))
+		} else {
+			set = fmt.Sprintf("%s, %s = EXCLUDED.%s", set, escaped(v), escaped(v))
+		}
+	}
+	if set == "" {
+		return fmt.Sprintf("%s DO NOTHING", clause), nil
+	}
+	clause = fmt.Sprintf("%s DO UPDATE SET %s", clause, set)
+	if c.where != "" {
+		clause = fmt.Sprintf("%s WHERE ( %s )", clause, renumber(c.where, index))
+	}
+	return clause, c.args
+}
+
+// renumber 将SQL中的占位符 $n 整体后移 offset 位, 如 offset 为 2 时 $1 => $3
+func renumber(s string, offset int) string {
+	if offset == 0 || strings.Index(s, dollar) < 0 {
+		return s
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if !strings.HasPrefix(s[i:], dollar) {
+			b.WriteByte(s[i])
+			continue
+		}
+		j := i + len(dollar)
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(s[i+len(dollar) : j])
+		if err != nil {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteString(dollars(n + offset))
+		i = j - 1
+	}
+	return b.String()
+}
+
+// inserts 执行带 RETURNING 子句的批量插入, 返回的主键按 VALUES 的顺序写回结构体, ON CONFLICT 时通过 xmax 区分插入和更新的行数
+func (x *Curd) inserts(b *batched) {
+	var err error
+	x.ri0()
+	defer func() {
+		x.error = err
+	}()
+	if x.record(b.SQL, b.Args) {
+		return
+	}
+	e, err := x.before(b.SQL, b.Args)
+	if err != nil {
+		return
+	}
+	defer func() {
+		x.after(e, x.rows, err)
+	}()
+	rows, err := x.queryContext(e.Context, e.SQL, e.Args)
+	if err != nil {
+		x.abort()
+		return
+	}
+	defer rows.Close()
+	pks := b.mapping.pks
+	keys := [][]reflect.Value{} // 每一行返回的主键
+	inserted := false
+	for rows.Next() {
+		key := make([]reflect.Value, len(pks))
+		dest := make([]interface{}, 0, len(pks)+1)
+		for i, f := range pks {
+			key[i] = reflect.New(b.values[0].FieldByIndex(f.index).Type())
+			dest = append(dest, key[i].Interface())
+		}
+		if x.conflict != nil {
+			dest = append(dest, &inserted)
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		keys = append(keys, key)
+		x.rows++
+		if x.conflict == nil {
+			continue
+		}
+		if inserted {
+			x.inserted++
+		} else {
+			x.updated++
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	// DO NOTHING 跳过的行没有返回值, 无法与结构体一一对应, 不写回主键
+	if len(keys) != len(b.values) {
+		return
+	}
+	for i, key := range keys {
+		for j, f := range pks {
+			b.values[i].FieldByIndex(f.index).Set(key[j].Elem())
+		}
+	}
+	return
+}
@@ -0,0 +1,365 @@
+package pg
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// copying 构造 COPY FROM STDIN 的SQL以及每一行的值, 所有数据必须映射到同一张表
+// COPY 不能对单独的行使用 DEFAULT, 因此零值的主键和 omitempty 字段只有在所有行中都为零值时才会省略
+func (x *Curd) copying(batch ...interface{}) (string, string, [][]interface{}, error) {
+	if len(batch) == 0 {
+		return "", "", nil, nil
+	}
+	table := ""
+	var m *mapping
+	values := make([]reflect.Value, 0, len(batch))
+	for i, v := range batch {
+		if v == nil {
+			return "", "", nil, fmt.Errorf("element %d: %w", i, ErrNilData)
+		}
+		rt, rv := reflect.TypeOf(v), reflect.ValueOf(v)
+		if rt.Kind() != reflect.Ptr || rv.IsNil() || rt.Elem().Kind() != reflect.Struct {
+			return "", "", nil, fmt.Errorf("element %d: %w", i, ErrNotStructPointer)
+		}
+		if i == 0 {
+			table = x.named(v)
+			m = mapped(rt.Elem())
+		} else if named := x.named(v); named != table || mapped(rt.Elem()) != m {
+			return "", "", nil, fmt.Errorf("element %d: copy into %s, but the first element is %s", i, named, table)
+		}
+		values = append(values, rv.Elem())
+	}
+	// 在任意一行中需要插入的列
+	fields := []*field{}
+	for _, f := range m.fields {
+		if f.readonly {
+			continue
+		}
+		for _, v := range values {
+			if f.insertable(v.FieldByIndex(f.index)) {
+				fields = append(fields, f)
+				break
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return "", "", nil, fmt.Errorf("no columns to copy into %s", table)
+	}
+	columns := ""
+	rows := make([][]interface{}, len(values))
+	for _, f := range fields {
+		if columns == "" {
+			columns = escaped(f.column)
+		} else {
+			columns = fmt.Sprintf("%s, %s", columns, escaped(f.column))
+		}
+	}
+	for i, v := range values {
+		for _, f := range fields {
+			if !f.insertable(v.FieldByIndex(f.index)) {
+				return "", "", nil, fmt.Errorf("element %d: column %s is empty, but other elements have a value", i, f.column)
+			}
+			rows[i] = append(rows[i], v.FieldByIndex(f.index).Interface())
+		}
+	}
+	// lib/pq 对 COPY 开头的预处理语句使用 COPY 协议, 与 pq.CopyIn 生成的SQL相同
+	return table, fmt.Sprintf("COPY %s ( %s ) FROM STDIN", table, columns), rows, nil
+}
+
+// CopyIn 使用 COPY FROM STDIN 批量插入同一张表的数据, 字段映射规则与 Add 相同, Rows() 为插入的行数
+// 没有开启事务时在隐式事务中执行, 不支持 ON CONFLICT 和 RETURNING
+func (x *Curd) CopyIn(batch ...interface{}) {
+	defer x.clear()
+	x.ri0()
+	table, query, rows, err := x.copying(batch...)
+	if err != nil || query == "" {
+		x.error = err
+		return
+	}
+	if x.tx == nil && !x.dryrun {
+		x.implicit(func() {
+			x.copyIn(table, query, rows)
+		})
+		return
+	}
+	x.copyIn(table, query, rows)
+}
+
+// BulkInsert 同 CopyIn, batch 为 []*AnyStruct
+func (x *Curd) BulkInsert(batch interface{}) {
+	rv := reflect.ValueOf(batch)
+	if rv.Kind() != reflect.Slice {
+		x.clear()
+		x.ri0()
+		x.error = fmt.Errorf("%w: need a slice of structure pointers", ErrInvalidResult)
+		return
+	}
+	elements := make([]interface{}, rv.Len())
+	for i := range elements {
+		elements[i] = rv.Index(i).Interface()
+	}
+	x.CopyIn(elements...)
+}
+
+// copyIn 逐行发送数据, 最后一次不带参数的执行结束 COPY
+func (x *Curd) copyIn(table string, query string, rows [][]interface{}) {
+	var err error
+	var count int64
+	defer func() {
+		x.error = err
+		x.rows = count
+	}()
+	x.operate(OpInsert, table)
+	if x.record(query, nil) {
+		return
+	}
+	e, err := x.before(query, nil)
+	if err != nil {
+		return
+	}
+	defer func() {
+		x.after(e, count, err)
+	}()
+	// COPY 语句不能缓存
+	stmt, err := x.conn().PrepareContext(e.Context, e.SQL)
+	if err != nil {
+		x.abort()
+		return
+	}
+	for _, row := range rows {
+		if _, err = stmt.ExecContext(e.Context, row...); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = stmt.ExecContext(e.Context)
+	}
+	if closed := stmt.Close(); err == nil {
+		err = closed
+	}
+	if err != nil {
+		x.abort()
+		return
+	}
+	count = int64(len(rows))
+}
+
+// CopyFormat CopyTo 输出的格式, 与 COPY ... TO STDOUT WITH ( FORMAT ... ) 一致
+type CopyFormat string
+
+const (
+	CopyCSV    CopyFormat = "csv"    // CSV, 第一行为列名
+	CopyText   CopyFormat = "text"   // 制表符分隔, NULL 输出为 \N
+	CopyBinary CopyFormat = "binary" // PGCOPY 二进制格式
+)
+
+// CopyTo 将当前查询条件的结果以 format 格式逐行写入 w, Rows() 为写入的行数, 没有调用 Limit 时导出所有匹配的数据
+// lib/pq 不支持 COPY TO STDOUT 协议, 每一列的值由数据库生成: csv, text 为类型的输出函数(与 COPY 相同), 在客户端加上分隔符和转义;
+// binary 为 record_send 的结果, 即每一列的二进制发送格式, 在客户端转换为 PGCOPY 的格式. 结果集不会全部读入内存
+// csv, text 需要先执行一次 LIMIT 0 的查询获取列名, dry run 时只记录这一条查询; 需要 PostgreSQL 9.6 以上(num_nulls)
+func (x *Curd) CopyTo(w io.Writer, format CopyFormat) {
+	var err error
+	var count int64
+	defer x.clear()
+	x.ri0()
+	defer func() {
+		x.error = err
+		x.rows = count
+	}()
+	if format != CopyCSV && format != CopyText && format != CopyBinary {
+		err = fmt.Errorf("%w: %s", ErrCopyFormat, format)
+		return
+	}
+	if _, _, err = x.selects(); err != nil {
+		return
+	}
+	table, query, args := x.from(), x.sql, x.args
+	bw := bufio.NewWriter(w)
+	defer func() {
+		if flushed := bw.Flush(); err == nil {
+			err = flushed
+		}
+	}()
+	if format == CopyBinary {
+		count, err = x.copyBinary(bw, table, query, args)
+		return
+	}
+	// 列名
+	var columns []string
+	if _, err = x.stream(table, fmt.Sprintf("SELECT * FROM ( %s ) AS t LIMIT 0", query), args, func(rows *sql.Rows) (err error) {
+		columns, err = rows.Columns()
+		return
+	}, nil); err != nil || x.dryrun {
+		return
+	}
+	record := make([]string, len(columns))
+	null := make([]bool, len(columns))
+	write := func() error {
+		_, err := bw.WriteString(copyLine(format, record, null))
+		return err
+	}
+	if format == CopyCSV {
+		// HEADER
+		copy(record, columns)
+		if err = write(); err != nil {
+			return
+		}
+	}
+	// format('%s', v) 使用类型的输出函数, 与 COPY 输出的文本一致, 例如 float8 的 1234567, bool 的 t, timestamp 的 infinity
+	values, aliases := "", ""
+	for i := range columns {
+		column := fmt.Sprintf(`t."%d"`, i+1)
+		value := fmt.Sprintf("CASE WHEN num_nulls( %s ) = 1 THEN NULL ELSE format( '%%s', %s ) END", column, column)
+		if i == 0 {
+			values, aliases = value, fmt.Sprintf(`"%d"`, i+1)
+		} else {
+			values, aliases = fmt.Sprintf("%s, %s", values, value), fmt.Sprintf(`%s, "%d"`, aliases, i+1)
+		}
+	}
+	fields := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range fields {
+		dest[i] = &fields[i]
+	}
+	query = fmt.Sprintf("SELECT %s FROM ( %s ) AS t ( %s )", values, query, aliases)
+	count, err = x.stream(table, query, args, nil, func(rows *sql.Rows) error {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, f := range fields {
+			record[i], null[i] = f.String, !f.Valid
+		}
+		return write()
+	})
+}
+
+// copyHeader PGCOPY 二进制格式的文件头: 签名, 标志位, 扩展区长度
+var copyHeader = []byte("PGCOPY\n\377\r\n\000\000\000\000\000\000\000\000\000")
+
+// copyBinary 以 PGCOPY 二进制格式写入查询结果
+// record_send 的结果为: 列数(int32), 每一列的类型 oid(int32), 长度(int32, NULL 为 -1), 值; PGCOPY 的每一行为: 列数(int16), 每一列的长度(int32), 值
+func (x *Curd) copyBinary(w *bufio.Writer, table string, query string, args []interface{}) (int64, error) {
+	var record []byte
+	write := func() error {
+		if len(record) < 4 {
+			return fmt.Errorf("%w: invalid record_send result", ErrCopyFormat)
+		}
+		columns := binary.BigEndian.Uint32(record)
+		if columns > math.MaxInt16 {
+			return fmt.Errorf("%w: too many columns", ErrCopyFormat)
+		}
+		line := make([]byte, 2, len(record))
+		binary.BigEndian.PutUint16(line, uint16(columns))
+		for i, rest := uint32(0), record[4:]; i < columns; i++ {
+			if len(rest) < 8 {
+				return fmt.Errorf("%w: invalid record_send result", ErrCopyFormat)
+			}
+			// 跳过类型 oid
+			size := int32(binary.BigEndian.Uint32(rest[4:]))
+			n := 8
+			if size > 0 {
+				n += int(size)
+			}
+			if len(rest) < n {
+				return fmt.Errorf("%w: invalid record_send result", ErrCopyFormat)
+			}
+			line = append(line, rest[4:n]...)
+			rest = rest[n:]
+		}
+		_, err := w.Write(line)
+		return err
+	}
+	query = fmt.Sprintf("SELECT record_send( t ) FROM ( %s ) AS t", query)
+	if x.dryrun {
+		_, err := x.stream(table, query, args, nil, nil)
+		return 0, err
+	}
+	if _, err := w.Write(copyHeader); err != nil {
+		return 0, err
+	}
+	count, err := x.stream(table, query, args, nil, func(rows *sql.Rows) error {
+		if err := rows.Scan(&record); err != nil {
+			return err
+		}
+		return write()
+	})
+	if err != nil {
+		return count, err
+	}
+	// 文件尾
+	_, err = w.Write([]byte{0xff, 0xff})
+	return count, err
+}
+
+// stream 执行 CopyTo 的一条查询, head 读取结果集的列信息, fn 逐行读取结果, 返回读取的行数
+func (x *Curd) stream(table string, query string, args []interface{}, head func(rows *sql.Rows) error, fn func(rows *sql.Rows) error) (count int64, err error) {
+	x.operate(OpSelect, table)
+	if x.record(query, args) {
+		return 0, nil
+	}
+	e, err := x.before(query, args)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		x.after(e, count, err)
+	}()
+	rows, err := x.queryContext(e.Context, e.SQL, e.Args)
+	if err != nil {
+		x.abort()
+		return 0, err
+	}
+	defer rows.Close()
+	if head != nil {
+		if err = head(rows); err != nil {
+			return 0, err
+		}
+	}
+	for rows.Next() {
+		if fn != nil {
+			if err = fn(rows); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// escaper text 格式中需要转义的字符
+var escaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// copyLine 按照 COPY 的规则格式化一行
+// csv: NULL 为不加引号的空值, 空字符串以及包含分隔符, 引号, 换行的值加引号; text: NULL 为 \N, 特殊字符使用反斜杠转义
+func copyLine(format CopyFormat, record []string, null []bool) string {
+	b := strings.Builder{}
+	for i, v := range record {
+		if i > 0 {
+			if format == CopyCSV {
+				b.WriteByte(',')
+			} else {
+				b.WriteByte('\t')
+			}
+		}
+		switch {
+		case format != CopyCSV && null[i]:
+			b.WriteString(`\N`)
+		case format != CopyCSV:
+			b.WriteString(escaper.Replace(v))
+		case null[i]:
+		case v == "" || v == `\.` || strings.ContainsAny(v, ",\"\r\n"):
+			b.WriteString(fmt.Sprintf(`"%s"`, strings.Replace(v, `"`, `""`, -1)))
+		default:
+			b.WriteString(v)
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package pg
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCopyLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		format CopyFormat
+		record []string
+		null   []bool
+		want   string
+	}{
+		{"csv null and empty string", CopyCSV, []string{"", ""}, []bool{true, false}, ",\"\"\n"},
+		{"csv quoting", CopyCSV, []string{"a,b", `say "hi"`, "x\ny", `\.`, "plain"}, make([]bool, 5), "\"a,b\",\"say \"\"hi\"\"\",\"x\ny\",\"\\.\",plain\n"},
+		{"text null and empty string", CopyText, []string{"", ""}, []bool{true, false}, "\\N\t\n"},
+		{"text escaping", CopyText, []string{"a\tb", "c\nd", `e\f`}, make([]bool, 3), "a\\tb\tc\\nd\te\\\\f\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := copyLine(tt.format, tt.record, tt.null); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyToCSV(t *testing.T) {
+	db, d := testDB(t.Name())
+	d.query = func(query string, args []driver.Value) (driver.Rows, error) {
+		if strings.HasSuffix(query, "LIMIT 0") {
+			return &testTable{columns: []string{"id", "score"}}, nil
+		}
+		// 值由数据库的输出函数格式化, 原样写入
+		return &testTable{columns: []string{"1", "2"}, values: [][]driver.Value{
+			{"1", "1234567"},
+			{"2", "1e+100"},
+			{nil, ""},
+		}}, nil
+	}
+	b := bytes.Buffer{}
+	x := NewClient(db).Table("user").WhereEqual("id", 1)
+	x.CopyTo(&b, CopyCSV)
+	if x.Error() != nil || x.Rows() != 3 {
+		t.Fatalf("got %v, %d rows", x.Error(), x.Rows())
+	}
+	if want := "id,score\n1,1234567\n2,1e+100\n,\"\"\n"; b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+	want := []string{
+		`SELECT * FROM ( SELECT * FROM "user" WHERE ( "id" = $1 ) ) AS t LIMIT 0`,
+		`SELECT CASE WHEN num_nulls( t."1" ) = 1 THEN NULL ELSE format( '%s', t."1" ) END, CASE WHEN num_nulls( t."2" ) = 1 THEN NULL ELSE format( '%s', t."2" ) END FROM ( SELECT * FROM "user" WHERE ( "id" = $1 ) ) AS t ( "1", "2" )`,
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestCopyToBinary(t *testing.T) {
+	db, d := testDB(t.Name())
+	d.query = func(query string, args []driver.Value) (driver.Rows, error) {
+		// record_send: 2 列, int4 7, text NULL
+		record := []byte{0, 0, 0, 2, 0, 0, 0, 23, 0, 0, 0, 4, 0, 0, 0, 7, 0, 0, 0, 25, 0xff, 0xff, 0xff, 0xff}
+		return &testTable{columns: []string{"record_send"}, values: [][]driver.Value{{record}}}, nil
+	}
+	b := bytes.Buffer{}
+	x := NewClient(db).Table("user")
+	x.CopyTo(&b, CopyBinary)
+	if x.Error() != nil || x.Rows() != 1 {
+		t.Fatalf("got %v, %d rows", x.Error(), x.Rows())
+	}
+	want := append([]byte("PGCOPY\n\377\r\n\000"), 0, 0, 0, 0, 0, 0, 0, 0)
+	want = append(want, 0, 2, 0, 0, 0, 4, 0, 0, 0, 7, 0xff, 0xff, 0xff, 0xff)
+	want = append(want, 0xff, 0xff)
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("got  %v\nwant %v", b.Bytes(), want)
+	}
+	if got := d.logged(); len(got) != 1 || got[0] != `SELECT record_send( t ) FROM ( SELECT * FROM "user" ) AS t` {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCopyIn(t *testing.T) {
+	db, d := testDB(t.Name())
+	rows := [][]driver.Value{}
+	d.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		rows = append(rows, args)
+		return driver.RowsAffected(0), nil
+	}
+	x := NewClient(db).Table("user")
+	x.CopyIn(&testUser{Email: "a", Name: "x"}, &testUser{Email: "b", Name: "y"})
+	if x.Error() != nil || x.Rows() != 2 {
+		t.Fatalf("got %v, %d rows", x.Error(), x.Rows())
+	}
+	// 没有开启事务时在隐式事务中执行, 主键在所有行中都为零值, 省略
+	query := `COPY "user" ( "email", "name" ) FROM STDIN`
+	if got, want := d.logged(), []string{"BEGIN", query, query, query, "COMMIT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if want := [][]driver.Value{{"a", "x"}, {"b", "y"}, {}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %v, want %v", rows, want)
+	}
+}
+
+func TestCopyInMixed(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	tests := []struct {
+		name  string
+		batch []interface{}
+		want  string
+	}{
+		{"omitempty", []interface{}{&testUser{Email: "a", Name: "x"}, &testUser{Email: "b"}}, "element 1: column name is empty, but other elements have a value"},
+		{"primary key", []interface{}{&testUser{Email: "a"}, &testUser{Id: 2, Email: "b"}}, "element 0: column id is empty, but other elements have a value"},
+		{"tables", []interface{}{&testUser{Email: "a"}, &testInvoice{Total: 1}}, `element 1: copy into "billing"."invoice", but the first element is "user"`},
+	}
+	for _, tt := range tests {
+		x := c.Table("user")
+		x.CopyIn(tt.batch...)
+		if x.Error() == nil || x.Error().Error() != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.name, x.Error(), tt.want)
+		}
+	}
+	if got := d.logged(); len(got) != 0 {
+		t.Errorf("executed %q", got)
+	}
+}
@@ -0,0 +1,126 @@
+package pg
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Cursor 服务端游标, 只能在事务中使用, 同一个游标的所有数据来自声明游标时的同一个快照
+type Cursor struct {
+	x      *Curd
+	name   string // 游标名称
+	table  string // 查询的表名
+	closed bool
+}
+
+// Cursor 使用当前的查询条件声明游标 DECLARE name NO SCROLL CURSOR FOR SELECT ..., 没有调用 Limit 时查询所有匹配的数据
+func (x *Curd) Cursor() *Cursor {
+	defer x.clear()
+	x.cursors++
+	c := &Cursor{x: x, name: fmt.Sprintf("pg_cursor_%d", x.cursors), table: x.from()}
+	if x.tx == nil && !x.dryrun {
+		x.ri0()
+		x.error = ErrNotInTx
+		c.closed = true
+		return c
+	}
+	if _, _, err := x.selects(); err != nil {
+		x.ri0()
+		x.error = err
+		c.closed = true
+		return c
+	}
+	x.operate(OpSelect, c.table)
+	x.Exec(fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", quote(c.name), x.sql), x.args...)
+	c.closed = x.error != nil
+	return c
+}
+
+// Fetch FETCH FORWARD n, result 为 *[]*AnyStruct, 返回读取的行数, 为 0 时没有更多数据
+func (c *Cursor) Fetch(n int, result interface{}) (int64, error) {
+	x := c.x
+	if c.closed {
+		x.ri0()
+		x.error = ErrIteratorClosed
+		return 0, x.error
+	}
+	x.result = result
+	x.operate(OpSelect, c.table)
+	x.returning(fmt.Sprintf("FETCH FORWARD %d FROM %s", n, quote(c.name)))
+	x.result = nil
+	return x.rows, x.error
+}
+
+// Close CLOSE name, 事务结束时游标自动关闭
+func (c *Cursor) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.x.Exec(fmt.Sprintf("CLOSE %s", quote(c.name)))
+	return c.x.error
+}
+
+// Chunk 使用游标每次读取 size 行, fn 为 func(batch []*AnyStruct) error, fn 返回错误时停止读取, 该错误作为执行结果
+// 没有开启事务时在隐式事务中执行, Rows() 为读取的总行数
+func (x *Curd) Chunk(size int, fn interface{}) {
+	ft, fv := reflect.TypeOf(fn), reflect.ValueOf(fn)
+	if ft == nil || ft.Kind() != reflect.Func || fv.IsNil() ||
+		ft.NumIn() != 1 || ft.In(0).Kind() != reflect.Slice ||
+		ft.In(0).Elem().Kind() != reflect.Ptr || ft.In(0).Elem().Elem().Kind() != reflect.Struct ||
+		ft.NumOut() != 1 || ft.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		x.clear()
+		x.ri0()
+		x.error = fmt.Errorf("%w: need a func(batch []*AnyStruct) error", ErrInvalidResult)
+		return
+	}
+	if size <= 0 {
+		x.clear()
+		x.ri0()
+		x.error = fmt.Errorf("%w: chunk size must be greater than 0", ErrInvalidResult)
+		return
+	}
+	if x.tx == nil && !x.dryrun {
+		x.implicit(func() {
+			x.chunk(size, ft, fv)
+		})
+		return
+	}
+	x.chunk(size, ft, fv)
+}
+
+// chunk 声明游标并分批读取
+func (x *Curd) chunk(size int, ft reflect.Type, fv reflect.Value) {
+	c := x.Cursor()
+	if x.error != nil {
+		return
+	}
+	var total int64
+	var err error
+	for {
+		batch := reflect.New(ft.In(0))
+		var n int64
+		if n, err = c.Fetch(size, batch.Interface()); err != nil {
+			// 执行失败的事务中不能再关闭游标
+			x.error = err
+			x.rows = total
+			return
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		if out := fv.Call([]reflect.Value{batch.Elem()})[0]; !out.IsNil() {
+			err = out.Interface().(error)
+			break
+		}
+		if n < int64(size) {
+			break
+		}
+	}
+	if e := c.Close(); err == nil {
+		err = e
+	}
+	x.error = err
+	x.rows = total
+}
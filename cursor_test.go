@@ -0,0 +1,104 @@
+package pg
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testCursor 游标共有 total 行数据, FETCH FORWARD n 每次最多返回 n 行
+func testCursor(d *testDriver, total int) {
+	d.query = func(query string, args []driver.Value) (driver.Rows, error) {
+		n, name := 0, ""
+		if _, err := fmt.Sscanf(query, "FETCH FORWARD %d FROM %s", &n, &name); err != nil {
+			return nil, err
+		}
+		rows := &testTable{columns: []string{"id", "name"}}
+		for ; n > 0 && total > 0; n-- {
+			rows.values = append(rows.values, []driver.Value{int64(total), "name"})
+			total--
+		}
+		return rows, nil
+	}
+}
+
+func TestChunk(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		batches []int
+		fetches int
+	}{
+		{"last batch is short", 5, []int{2, 2, 1}, 3},
+		{"last batch is full", 4, []int{2, 2}, 3},
+		{"no rows", 0, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, d := testDB(t.Name())
+			testCursor(d, tt.total)
+			batches := []int(nil)
+			x := NewClient(db).Table("user")
+			x.Chunk(2, func(batch []*testRow) error {
+				batches = append(batches, len(batch))
+				return nil
+			})
+			if x.Error() != nil || x.Rows() != int64(tt.total) || !reflect.DeepEqual(batches, tt.batches) {
+				t.Fatalf("got %v, %d rows, batches %v", x.Error(), x.Rows(), batches)
+			}
+			// 没有开启事务时在隐式事务中执行
+			want := []string{"BEGIN", `DECLARE "pg_cursor_1" NO SCROLL CURSOR FOR SELECT * FROM "user"`}
+			for i := 0; i < tt.fetches; i++ {
+				want = append(want, `FETCH FORWARD 2 FROM "pg_cursor_1"`)
+			}
+			want = append(want, `CLOSE "pg_cursor_1"`, "COMMIT")
+			if got := d.logged(); !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %q\nwant %q", got, want)
+			}
+		})
+	}
+}
+
+func TestChunkStopsOnError(t *testing.T) {
+	db, d := testDB(t.Name())
+	testCursor(d, 5)
+	stop := errors.New("stop")
+	x := NewClient(db).Table("user")
+	x.Chunk(2, func(batch []*testRow) error {
+		return stop
+	})
+	if x.Error() != stop || x.Rows() != 2 {
+		t.Fatalf("got %v, %d rows", x.Error(), x.Rows())
+	}
+	// fn 出错之后关闭游标, 隐式事务回滚
+	want := []string{
+		"BEGIN",
+		`DECLARE "pg_cursor_1" NO SCROLL CURSOR FOR SELECT * FROM "user"`,
+		`FETCH FORWARD 2 FROM "pg_cursor_1"`,
+		`CLOSE "pg_cursor_1"`,
+		"ROLLBACK",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("%d connections in use", n)
+	}
+}
+
+func TestCursorNotInTx(t *testing.T) {
+	db, d := testDB(t.Name())
+	x := NewClient(db).Table("user")
+	c := x.Cursor()
+	if x.Error() != ErrNotInTx {
+		t.Fatalf("got %v", x.Error())
+	}
+	if _, err := c.Fetch(1, &[]*testRow{}); err != ErrIteratorClosed {
+		t.Errorf("got %v", err)
+	}
+	if got := d.logged(); len(got) != 0 {
+		t.Errorf("executed %q", got)
+	}
+}
@@ -0,0 +1,154 @@
+package pg
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+)
+
+// testDriver 不连接数据库的驱动, 记录预处理, 关闭以及执行的语句, 执行的语句包括 BEGIN, COMMIT, ROLLBACK
+// 没有设置 exec, query 时每个执行影响 1 行, 每个查询返回 testRows 行 ( id, name )
+type testDriver struct {
+	mu       sync.Mutex
+	prepared []string
+	closed   []string
+	log      []string
+	exec     func(query string, args []driver.Value) (driver.Result, error)
+	query    func(query string, args []driver.Value) (driver.Rows, error)
+}
+
+// logged 执行过的语句
+func (d *testDriver) logged() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.log...)
+}
+
+func (d *testDriver) record(query string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, query)
+}
+
+const testRows = 3
+
+var drivers = map[string]*testDriver{}
+
+func init() {
+	sql.Register("pgtest", testDriverFunc(func(name string) *testDriver {
+		return drivers[name]
+	}))
+}
+
+// testDB 打开使用独立 testDriver 的连接
+func testDB(name string) (*sql.DB, *testDriver) {
+	d := &testDriver{}
+	drivers[name] = d
+	db, _ := sql.Open("pgtest", name)
+	return db, d
+}
+
+type testDriverFunc func(name string) *testDriver
+
+func (f testDriverFunc) Open(name string) (driver.Conn, error) {
+	return &testConn{d: f(name)}, nil
+}
+
+type testConn struct {
+	d *testDriver
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.prepared = append(c.d.prepared, query)
+	return &testStmt{d: c.d, query: query}, nil
+}
+
+func (c *testConn) Close() error { return nil }
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	c.d.record("BEGIN")
+	return &testTx{d: c.d}, nil
+}
+
+// testTx 记录 COMMIT, ROLLBACK
+type testTx struct {
+	d *testDriver
+}
+
+func (tx *testTx) Commit() error {
+	tx.d.record("COMMIT")
+	return nil
+}
+
+func (tx *testTx) Rollback() error {
+	tx.d.record("ROLLBACK")
+	return nil
+}
+
+type testStmt struct {
+	d     *testDriver
+	query string
+}
+
+func (s *testStmt) Close() error {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.closed = append(s.d.closed, s.query)
+	return nil
+}
+
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.record(s.query)
+	if s.d.exec != nil {
+		return s.d.exec(s.query, args)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.record(s.query)
+	if s.d.query != nil {
+		return s.d.query(s.query, args)
+	}
+	return &testResult{n: testRows}, nil
+}
+
+type testResult struct {
+	n int
+}
+
+func (r *testResult) Columns() []string { return []string{"id", "name"} }
+func (r *testResult) Close() error      { return nil }
+
+func (r *testResult) Next(dest []driver.Value) error {
+	if r.n == 0 {
+		return io.EOF
+	}
+	dest[0] = int64(r.n)
+	dest[1] = "name"
+	r.n--
+	return nil
+}
+
+// testTable 指定列名和每一行的值的结果集
+type testTable struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *testTable) Columns() []string { return r.columns }
+func (r *testTable) Close() error      { return nil }
+
+func (r *testTable) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
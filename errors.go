@@ -0,0 +1,136 @@
+package pg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrNotFound 查询一条数据时没有匹配的数据
+	ErrNotFound = errors.New("record not found")
+	// ErrNoRows 同 ErrNotFound
+	ErrNoRows = ErrNotFound
+	// ErrNoWhere 没有指定条件的 UPDATE, DELETE
+	ErrNoWhere = errors.New("update or delete without where condition")
+	// ErrNilData 插入的数据为 nil
+	ErrNilData = errors.New("insert data is nil")
+	// ErrNotStructPointer 插入的数据不是结构体指针
+	ErrNotStructPointer = errors.New("insert data need a structure pointer")
+	// ErrNeedPointer 接收结果的参数不是指针
+	ErrNeedPointer = errors.New("need a pointer parameter")
+	// ErrInvalidResult 接收结果的参数类型与查询不匹配
+	ErrInvalidResult = errors.New("invalid result parameter")
+	// ErrLockWithoutTx 行锁子句必须在事务中使用
+	ErrLockWithoutTx = errors.New("locking clause requires a transaction")
+	// ErrNotInTx 只能在事务中执行的操作
+	ErrNotInTx = errors.New("requires a transaction")
+	// ErrIteratorClosed 迭代器已经关闭
+	ErrIteratorClosed = errors.New("iterator is closed")
+	// ErrConflictTarget DO UPDATE 没有指定冲突目标 OnConflict 或 OnConstraint
+	ErrConflictTarget = errors.New("on conflict do update requires a conflict target")
+	// ErrCopyFormat 不支持的 CopyTo 输出格式
+	ErrCopyFormat = errors.New("unsupported copy format")
+)
+
+// ErrMissingField 结构体缺少结果集中的列对应的字段, 或者该字段不可访问(小写字母开头)
+type ErrMissingField struct {
+	Field  string // 期望的字段名
+	Column string // 结果集中的列名
+}
+
+func (e *ErrMissingField) Error() string {
+	return fmt.Sprintf("structure is missing fields: %s", e.Field)
+}
+
+// ErrTooManyRows UPDATE, DELETE 受影响的行数超过 MaxRows 的限制, 该语句已被撤销
+type ErrTooManyRows struct {
+	Max  int64 // 允许的最大行数
+	Rows int64 // 实际受影响的行数
+}
+
+func (e *ErrTooManyRows) Error() string {
+	return fmt.Sprintf("affected %d rows, exceeds the limit of %d", e.Rows, e.Max)
+}
+
+// Postgres SQLSTATE 错误码
+const (
+	CodeNotNullViolation     = "23502"
+	CodeForeignKeyViolation  = "23503"
+	CodeUniqueViolation      = "23505"
+	CodeCheckViolation       = "23514"
+	CodeExclusionViolation   = "23P01"
+	CodeSerializationFailure = "40001"
+	CodeDeadlockDetected     = "40P01"
+	CodeLockNotAvailable     = "55P03"
+	CodeQueryCanceled        = "57014"
+)
+
+// AsPgError 取出错误链中的 *pq.Error
+func AsPgError(err error) (*pq.Error, bool) {
+	var pe *pq.Error
+	if errors.As(err, &pe) {
+		return pe, true
+	}
+	return nil, false
+}
+
+// Code 错误的 SQLSTATE, 不是 Postgres 返回的错误时为空字符串
+func Code(err error) string {
+	if pe, ok := AsPgError(err); ok {
+		return string(pe.Code)
+	}
+	return ""
+}
+
+// ConstraintName 违反约束的错误中约束的名称
+func ConstraintName(err error) string {
+	if pe, ok := AsPgError(err); ok {
+		return pe.Constraint
+	}
+	return ""
+}
+
+// ColumnName 错误关联的列名, 如违反非空约束的列
+func ColumnName(err error) string {
+	if pe, ok := AsPgError(err); ok {
+		return pe.Column
+	}
+	return ""
+}
+
+func IsNotNullViolation(err error) bool {
+	return Code(err) == CodeNotNullViolation
+}
+
+func IsForeignKeyViolation(err error) bool {
+	return Code(err) == CodeForeignKeyViolation
+}
+
+func IsUniqueViolation(err error) bool {
+	return Code(err) == CodeUniqueViolation
+}
+
+func IsCheckViolation(err error) bool {
+	return Code(err) == CodeCheckViolation
+}
+
+func IsExclusionViolation(err error) bool {
+	return Code(err) == CodeExclusionViolation
+}
+
+func IsSerializationFailure(err error) bool {
+	return Code(err) == CodeSerializationFailure
+}
+
+func IsDeadlock(err error) bool {
+	return Code(err) == CodeDeadlockDetected
+}
+
+func IsLockNotAvailable(err error) bool {
+	return Code(err) == CodeLockNotAvailable
+}
+
+func IsQueryCanceled(err error) bool {
+	return Code(err) == CodeQueryCanceled
+}
@@ -0,0 +1,204 @@
+package pg
+
+import (
+	"github.com/xooooooox/utils"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// tag 结构体字段映射列名使用的标签, 如: `db:"user_id,pk"`, `db:"-"`
+const tag = "db"
+
+// field 结构体字段与表中列的映射信息
+type field struct {
+	index     []int  // 字段在结构体中的序号, 匿名结构体中的字段为逐层的序号
+	name      string // 字段名
+	column    string // 列名, 未设置标签时为字段名的下划线形式
+	tagged    bool   // 是否设置了 db 标签
+	pk        bool   // 主键
+	readonly  bool   // 只读, 插入和更新时忽略
+	omitempty bool   // 零值时插入列的默认值
+}
+
+// PrimaryKeyer 结构体实现该接口时, 使用返回的列名作为主键
+type PrimaryKeyer interface {
+	PrimaryKey() []string
+}
+
+// mapping 结构体所有字段的映射信息
+type mapping struct {
+	fields  []*field          // 可映射的字段, 顺序与结构体字段一致
+	columns map[string]*field // 列名 => 字段
+	pks     []*field          // 主键字段
+}
+
+var mappings sync.Map // reflect.Type => *mapping
+
+// mapped 解析结构体的字段与列的映射关系
+func mapped(t reflect.Type) *mapping {
+	if m, ok := mappings.Load(t); ok {
+		return m.(*mapping)
+	}
+	m := &mapping{
+		columns: map[string]*field{},
+	}
+	m.walk(t, nil)
+	// 按字段在结构体中的声明顺序排列
+	sort.SliceStable(m.fields, func(i, j int) bool {
+		a, b := m.fields[i].index, m.fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	// 主键优先级: PrimaryKey() 方法, pk 标签, 名称为 id 的列
+	if pk, ok := reflect.New(t).Interface().(PrimaryKeyer); ok {
+		for _, f := range m.fields {
+			f.pk = false
+		}
+		for _, column := range pk.PrimaryKey() {
+			if f, ok := m.columns[column]; ok {
+				f.pk = true
+				m.pks = append(m.pks, f)
+			}
+		}
+	} else {
+		for _, f := range m.fields {
+			if f.pk {
+				m.pks = append(m.pks, f)
+			}
+		}
+		if len(m.pks) == 0 {
+			if f, ok := m.columns[idname]; ok {
+				f.pk = true
+				m.pks = append(m.pks, f)
+			}
+		}
+	}
+	actual, _ := mappings.LoadOrStore(t, m)
+	return actual.(*mapping)
+}
+
+// walk 解析结构体的字段, 未设置标签的匿名结构体字段展开到外层(与 Go 的字段提升一致), 外层的同名列优先
+// 匿名结构体指针字段可能为 nil, 不展开
+func (m *mapping) walk(t reflect.Type, parent []int) {
+	embedded := []int{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		value, ok := sf.Tag.Lookup(tag)
+		if sf.Anonymous && !ok && sf.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, i)
+			continue
+		}
+		if sf.PkgPath != "" {
+			// 不可访问的字段(小写字母开头)
+			continue
+		}
+		f := &field{
+			index:  append(append([]int{}, parent...), i),
+			name:   sf.Name,
+			column: utils.PascalToUnderline(sf.Name),
+		}
+		if ok {
+			if value == "-" {
+				continue
+			}
+			f.tagged = true
+			options := strings.Split(value, ",")
+			if name := strings.TrimSpace(options[0]); name != "" {
+				f.column = name
+			}
+			for _, option := range options[1:] {
+				switch strings.TrimSpace(option) {
+				case "pk":
+					f.pk = true
+				case "readonly":
+					f.readonly = true
+				case "omitempty":
+					f.omitempty = true
+				}
+			}
+		}
+		if _, ok := m.columns[f.column]; ok {
+			// 外层已经有同名的列
+			continue
+		}
+		m.fields = append(m.fields, f)
+		m.columns[f.column] = f
+	}
+	for _, i := range embedded {
+		m.walk(t.Field(i).Type, append(append([]int{}, parent...), i))
+	}
+}
+
+// field 结果集列名对应的字段, 兼容未设置标签时的下划线转帕斯卡命名
+func (m *mapping) field(column string) *field {
+	if f, ok := m.columns[column]; ok {
+		return f
+	}
+	column = strings.ToLower(column)
+	if f, ok := m.columns[column]; ok {
+		return f
+	}
+	name := utils.UnderlineToPascal(column)
+	for _, f := range m.fields {
+		if !f.tagged && f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// insertable 插入数据时是否写入该字段, 零值的主键和 omitempty 字段使用列的默认值
+func (f *field) insertable(value reflect.Value) bool {
+	if f.readonly {
+		return false
+	}
+	if (f.pk || f.omitempty) && value.IsZero() {
+		return false
+	}
+	return true
+}
+
+// keys 主键的列名
+func (m *mapping) keys() []string {
+	keys := make([]string, 0, len(m.pks))
+	for _, f := range m.pks {
+		keys = append(keys, f.column)
+	}
+	return keys
+}
+
+// key 结构体的主键值, 复合主键时为 []interface{}
+func (m *mapping) key(v reflect.Value) interface{} {
+	if len(m.pks) == 0 {
+		return nil
+	}
+	if len(m.pks) == 1 {
+		return v.FieldByIndex(m.pks[0].index).Interface()
+	}
+	key := make([]interface{}, 0, len(m.pks))
+	for _, f := range m.pks {
+		key = append(key, v.FieldByIndex(f.index).Interface())
+	}
+	return key
+}
+
+// id 整数类型的单一主键值, 其他类型时为 0
+func (m *mapping) id(v reflect.Value) int64 {
+	if len(m.pks) != 1 {
+		return 0
+	}
+	value := v.FieldByIndex(m.pks[0].index)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint())
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testBase struct {
+	Id int64 `db:"id"`
+}
+
+// testEmbedded 匿名结构体的字段展开到外层
+type testEmbedded struct {
+	testBase
+	Name string `db:"name"`
+}
+
+func (testEmbedded) TableName() string {
+	return "user"
+}
+
+// testShadowed 外层的同名列优先
+type testShadowed struct {
+	testBase
+	Id   string `db:"id"`
+	Name string `db:"name"`
+}
+
+func TestMappedEmbedded(t *testing.T) {
+	m := mapped(reflect.TypeOf(testEmbedded{}))
+	if len(m.fields) != 2 || m.fields[0].column != "id" || m.fields[1].column != "name" {
+		t.Fatalf("got %d fields", len(m.fields))
+	}
+	if len(m.pks) != 1 || m.pks[0].column != "id" {
+		t.Fatalf("got %d primary keys", len(m.pks))
+	}
+	if f := mapped(reflect.TypeOf(testShadowed{})).field("id"); f == nil || len(f.index) != 1 || f.index[0] != 1 {
+		t.Fatal("embedded column shadows the outer one")
+	}
+}
+
+func TestGetEmbedded(t *testing.T) {
+	db, _ := testDB(t.Name())
+	row := testEmbedded{}
+	x := NewClient(db).Table("user")
+	x.Get(&row)
+	if x.Error() != nil {
+		t.Fatal(x.Error())
+	}
+	if row.Id != testRows || row.Name != "name" {
+		t.Fatalf("got %+v", row)
+	}
+}
+
+func TestAddSQLEmbedded(t *testing.T) {
+	query, args, err := Table("user").AddSQL(&testEmbedded{testBase: testBase{Id: 1}, Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO "user" ( "id", "name" ) VALUES ( $1, $2 ) RETURNING "id"`
+	if query != want {
+		t.Errorf("got  %s\nwant %s", query, want)
+	}
+	if len(args) != 2 || args[0] != int64(1) {
+		t.Errorf("got %v", args)
+	}
+}
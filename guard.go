@@ -0,0 +1,81 @@
+package pg
+
+// AllowFullTable 允许接下来的 Del, Ups 不指定条件, 操作整张表的数据
+func (x *Curd) AllowFullTable() *Curd {
+	x.full = true
+	return x
+}
+
+// DeleteAll 删除整张表的数据
+func (x *Curd) DeleteAll() {
+	x.AllowFullTable().Del()
+}
+
+// UpdateAll 更新整张表的数据
+func (x *Curd) UpdateAll(ups ...map[string]interface{}) {
+	x.AllowFullTable().Ups(ups...)
+}
+
+// MaxRows 接下来的 Del, Ups 受影响的行数超过 n 时撤销该语句, Error() 返回 *ErrTooManyRows
+// 事务中在内部保存点中执行, 超过限制时回滚到该保存点, 只撤销该语句并记录为事务的执行错误; 没有开启事务时在隐式事务中执行
+func (x *Curd) MaxRows(n int64) *Curd {
+	x.max = n
+	return x
+}
+
+// unguarded 没有指定条件且没有调用 AllowFullTable 时拒绝执行
+func (x *Curd) unguarded() bool {
+	if x.where != "" || x.full {
+		return false
+	}
+	x.ri0()
+	x.error = ErrNoWhere
+	return true
+}
+
+// limited 执行 fn, 受影响的行数超过 MaxRows 时撤销
+func (x *Curd) limited(fn func()) {
+	max := x.max
+	if max <= 0 || x.dryrun {
+		fn()
+		return
+	}
+	if x.tx != nil {
+		// 调用方可能已经建立了保存点, 此时 abort 不会回滚, 因此使用内部保存点撤销该语句
+		const name = "pg_max_rows"
+		if x.Savepoint(name); x.error != nil {
+			return
+		}
+		fn()
+		err, rows := x.error, x.rows
+		if err == nil && rows <= max {
+			x.Release(name)
+			if x.error == nil {
+				x.rows = rows
+			}
+			return
+		}
+		exceeded := err == nil
+		if exceeded {
+			err = &ErrTooManyRows{Max: max, Rows: rows}
+		}
+		// 回滚到保存点时恢复了建立保存点时的执行错误
+		x.RollbackTo(name).Release(name)
+		if x.failed == nil {
+			x.failed = err
+		}
+		if !exceeded {
+			// 与没有 MaxRows 时相同, 执行出错时回滚事务
+			x.abort()
+		}
+		x.error = err
+		x.rows = rows
+		return
+	}
+	x.implicit(func() {
+		fn()
+		if x.error == nil && x.rows > max {
+			x.error = &ErrTooManyRows{Max: max, Rows: x.rows}
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNoWhere(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+
+	x := c.Table("user")
+	x.Del()
+	if x.Error() != ErrNoWhere {
+		t.Errorf("Del: got %v", x.Error())
+	}
+	x = c.Table("user").Mod("name", "a")
+	x.Ups()
+	if x.Error() != ErrNoWhere {
+		t.Errorf("Ups: got %v", x.Error())
+	}
+	if _, _, err := Table("user").DelSQL(); err != ErrNoWhere {
+		t.Errorf("DelSQL: got %v", err)
+	}
+	if _, _, err := Table("user").UpsSQL(map[string]interface{}{"name": "a"}); err != ErrNoWhere {
+		t.Errorf("UpsSQL: got %v", err)
+	}
+	if got := d.logged(); len(got) != 0 {
+		t.Errorf("executed %q", got)
+	}
+}
+
+func TestFullTable(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+
+	c.Table("user").DeleteAll()
+	c.Table("user").UpdateAll(map[string]interface{}{"name": "a"})
+	x := c.Table("user").AllowFullTable()
+	x.Del()
+	if x.Error() != nil || x.Rows() != 1 {
+		t.Fatalf("got %v, %d rows", x.Error(), x.Rows())
+	}
+	// AllowFullTable 只对接下来的一条语句有效
+	x.Del()
+	if x.Error() != ErrNoWhere {
+		t.Errorf("got %v, want ErrNoWhere", x.Error())
+	}
+	want := []string{`DELETE FROM "user"`, `UPDATE "user" SET "name" = $1`, `DELETE FROM "user"`}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if query, _, err := Table("user").AllowFullTable().DelSQL(); err != nil || query != `DELETE FROM "user"` {
+		t.Errorf("DelSQL: got %s, %v", query, err)
+	}
+}
+
+// testAffected DELETE 影响 n 行
+func testAffected(d *testDriver, n int64) {
+	d.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		if strings.HasPrefix(query, "DELETE") {
+			return driver.RowsAffected(n), nil
+		}
+		return driver.RowsAffected(0), nil
+	}
+}
+
+func TestMaxRowsImplicitTx(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	testAffected(d, 5)
+
+	x := c.Table("user").WhereEqual("id", 1).MaxRows(5)
+	x.Del()
+	if x.Error() != nil || x.Rows() != 5 {
+		t.Fatalf("got %v, %d rows", x.Error(), x.Rows())
+	}
+	x = c.Table("user").WhereEqual("id", 1).MaxRows(4)
+	x.Del()
+	var many *ErrTooManyRows
+	if !errors.As(x.Error(), &many) || many.Max != 4 || many.Rows != 5 {
+		t.Fatalf("got %v", x.Error())
+	}
+	want := []string{
+		"BEGIN", `DELETE FROM "user" WHERE ( "id" = $1 )`, "COMMIT",
+		"BEGIN", `DELETE FROM "user" WHERE ( "id" = $1 )`, "ROLLBACK",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestMaxRowsTx(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	testAffected(d, 5)
+
+	err := c.Transaction(context.Background(), nil, func(tx *Curd) error {
+		tx.Table("user").WhereEqual("id", 1).MaxRows(5).Del()
+		if tx.Error() != nil {
+			return tx.Error()
+		}
+		// 超过限制的错误没有检查, 作为事务的执行错误
+		tx.Table("user").WhereEqual("id", 2).MaxRows(4).Del()
+		return nil
+	})
+	var many *ErrTooManyRows
+	if !errors.As(err, &many) {
+		t.Fatalf("got %v", err)
+	}
+	want := []string{
+		"BEGIN",
+		`SAVEPOINT "pg_max_rows"`, `DELETE FROM "user" WHERE ( "id" = $1 )`, `RELEASE SAVEPOINT "pg_max_rows"`,
+		`SAVEPOINT "pg_max_rows"`, `DELETE FROM "user" WHERE ( "id" = $1 )`, `ROLLBACK TO SAVEPOINT "pg_max_rows"`, `RELEASE SAVEPOINT "pg_max_rows"`,
+		"ROLLBACK",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestMaxRowsSavepoint(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	testAffected(d, 5)
+
+	err := c.Transaction(context.Background(), nil, func(tx *Curd) error {
+		tx.Savepoint("sp")
+		tx.Table("user").WhereEqual("id", 1).MaxRows(4).Del()
+		var many *ErrTooManyRows
+		if !errors.As(tx.Error(), &many) {
+			t.Errorf("got %v", tx.Error())
+		}
+		// 该语句已经撤销, 回滚到调用方的保存点之后事务可以提交
+		tx.RollbackTo("sp")
+		return tx.Error()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"BEGIN",
+		`SAVEPOINT "sp"`,
+		`SAVEPOINT "pg_max_rows"`, `DELETE FROM "user" WHERE ( "id" = $1 )`, `ROLLBACK TO SAVEPOINT "pg_max_rows"`, `RELEASE SAVEPOINT "pg_max_rows"`,
+		`ROLLBACK TO SAVEPOINT "sp"`,
+		"COMMIT",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+package pg
+
+import (
+	"context"
+	"time"
+)
+
+// Operation 执行SQL的操作类型
+type Operation string
+
+const (
+	OpExec   Operation = "exec"
+	OpSelect Operation = "select"
+	OpInsert Operation = "insert"
+	OpUpdate Operation = "update"
+	OpDelete Operation = "delete"
+)
+
+// QueryEvent 一条SQL的执行信息, 钩子可以在 Before 中修改 SQL, Args 和 Context
+type QueryEvent struct {
+	Context   context.Context // 执行SQL使用的上下文
+	Operation Operation       // 操作类型
+	Table     string          // 操作的表名
+	SQL       string          // SQL
+	Args      []interface{}   // SQL args
+	Start     time.Time       // 开始执行的时间
+	Duration  time.Duration   // 执行耗时
+	Rows      int64           // 受影响(返回)的行数
+	Err       error           // 执行错误, 或者钩子中止执行的错误
+	called    int             // 已执行 Before 的钩子个数
+}
+
+// Hook 包裹每一条执行的SQL, Before 返回错误时中止执行该SQL, 该错误作为执行结果
+type Hook interface {
+	Before(ctx context.Context, e *QueryEvent) error
+	After(ctx context.Context, e *QueryEvent)
+}
+
+// hooks 全局钩子, 先于客户端的钩子执行
+var hooks []Hook
+
+// AddHook 添加全局钩子
+func AddHook(h Hook) {
+	hooks = append(hooks, h)
+}
+
+// AddHook 添加客户端钩子
+func (c *Client) AddHook(h Hook) {
+	c.hooks = append(c.hooks, h)
+}
+
+// operate 标记接下来执行的SQL的操作类型和表名
+func (x *Curd) operate(op Operation, table string) {
+	x.operation = op
+	x.target = table
+}
+
+// chain 当前构造器需要执行的所有钩子
+func (x *Curd) chain() []Hook {
+	if x.client == nil || len(x.client.hooks) == 0 {
+		return hooks
+	}
+	chain := make([]Hook, 0, len(hooks)+len(x.client.hooks))
+	chain = append(chain, hooks...)
+	return append(chain, x.client.hooks...)
+}
+
+// before 执行SQL之前依次调用钩子的 Before, 返回执行使用的事件信息
+func (x *Curd) before(query string, args []interface{}) (*QueryEvent, error) {
+	e := &QueryEvent{
+		Context:   x.context(),
+		Operation: x.operation,
+		Table:     x.target,
+		SQL:       query,
+		Args:      args,
+	}
+	if e.Operation == "" {
+		e.Operation = OpExec
+	}
+	x.operate("", "")
+	for _, h := range x.chain() {
+		if err := h.Before(e.Context, e); err != nil {
+			e.Start = time.Now()
+			x.after(e, 0, err)
+			return e, err
+		}
+		e.called++
+	}
+	e.Start = time.Now()
+	return e, nil
+}
+
+// after 执行SQL之后记录日志, 逆序调用已执行 Before 的钩子的 After
+func (x *Curd) after(e *QueryEvent, rows int64, err error) {
+	e.Duration = time.Since(e.Start)
+	e.Rows = rows
+	e.Err = err
+	if err != nil && x.tx != nil && x.failed == nil {
+		x.failed = err
+	}
+	x.log(e)
+	x.slow(e)
+	chain := x.chain()
+	for i := e.called - 1; i >= 0; i-- {
+		chain[i].After(e.Context, e)
+	}
+}
@@ -0,0 +1,97 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testHook 记录 Before, After 的调用顺序
+type testHook struct {
+	name    string
+	log     *[]string
+	abort   error             // Before 返回的错误
+	rewrite func(*QueryEvent) // Before 中修改事件
+	events  []QueryEvent      // After 收到的事件
+}
+
+func (h *testHook) Before(ctx context.Context, e *QueryEvent) error {
+	*h.log = append(*h.log, h.name+" before")
+	if h.rewrite != nil {
+		h.rewrite(e)
+	}
+	return h.abort
+}
+
+func (h *testHook) After(ctx context.Context, e *QueryEvent) {
+	*h.log = append(*h.log, h.name+" after")
+	h.events = append(h.events, *e)
+}
+
+func TestHookOrder(t *testing.T) {
+	defer func(saved []Hook) {
+		hooks = saved
+	}(hooks)
+	db, _ := testDB(t.Name())
+	c := NewClient(db)
+	log := []string{}
+	g := &testHook{name: "global", log: &log}
+	AddHook(g)
+	c.AddHook(&testHook{name: "a", log: &log})
+	c.AddHook(&testHook{name: "b", log: &log})
+
+	x := c.Table("user").WhereEqual("id", 1)
+	x.Del()
+	if x.Error() != nil {
+		t.Fatal(x.Error())
+	}
+	want := []string{"global before", "a before", "b before", "b after", "a after", "global after"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("got  %q\nwant %q", log, want)
+	}
+	e := g.events[0]
+	if e.Operation != OpDelete || e.Table != `"user"` || e.Rows != 1 || e.Err != nil {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestHookAbort(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	log := []string{}
+	stop := errors.New("stop")
+	a := &testHook{name: "a", log: &log}
+	c.AddHook(a)
+	c.AddHook(&testHook{name: "b", log: &log, abort: stop})
+	c.AddHook(&testHook{name: "c", log: &log})
+
+	x := c.Table("user")
+	x.Exec("UPDATE")
+	if x.Error() != stop {
+		t.Fatalf("got %v, want stop", x.Error())
+	}
+	// 只有 Before 已经执行的钩子调用 After
+	if want := []string{"a before", "b before", "a after"}; !reflect.DeepEqual(log, want) {
+		t.Errorf("got  %q\nwant %q", log, want)
+	}
+	if a.events[0].Err != stop {
+		t.Errorf("After got %v", a.events[0].Err)
+	}
+	if got := d.logged(); len(got) != 0 {
+		t.Errorf("executed %q", got)
+	}
+}
+
+func TestHookRewrite(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	log := []string{}
+	c.AddHook(&testHook{name: "a", log: &log, rewrite: func(e *QueryEvent) {
+		e.SQL = "/* app */ " + e.SQL
+	}})
+	c.Table("user").Exec("UPDATE")
+	if got, want := d.logged(), []string{"/* app */ UPDATE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
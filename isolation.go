@@ -0,0 +1,73 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BeginSnapshot 使用默认客户端开启 SERIALIZABLE READ ONLY DEFERRABLE 事务
+func BeginSnapshot(ctx context.Context) *Curd {
+	return defaultClient.BeginSnapshot(ctx)
+}
+
+// BeginSnapshot 开启 SERIALIZABLE READ ONLY DEFERRABLE 事务, 等待一个不会发生序列化失败的一致性快照, 适用于报表
+func (c *Client) BeginSnapshot(ctx context.Context) *Curd {
+	x := c.BeginCtx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	if x.error != nil {
+		return x
+	}
+	return x.Deferrable()
+}
+
+// Deferrable SET TRANSACTION DEFERRABLE, 必须在事务执行第一条查询之前调用, 仅对 SERIALIZABLE READ ONLY 事务生效
+func (x *Curd) Deferrable() *Curd {
+	if x.tx == nil {
+		x.error = ErrNotInTx
+		return x
+	}
+	x.Exec("SET TRANSACTION DEFERRABLE")
+	return x
+}
+
+// SetLocal SET LOCAL name = 'value', 设置只在当前事务中生效的配置
+// 使用不获取快照的工具语句(SELECT set_config 会获取快照), 之后仍然可以调用 Deferrable; SET 不支持占位符, value 转义为字符串常量
+func (x *Curd) SetLocal(name string, value string) *Curd {
+	if x.tx == nil {
+		x.error = ErrNotInTx
+		return x
+	}
+	x.Exec(fmt.Sprintf("SET LOCAL %s = %s", quote(name), literal(value)))
+	return x
+}
+
+// literal 转义为字符串常量, 单引号写两次, 包含反斜杠时使用 E 前缀并转义反斜杠, 不依赖 standard_conforming_strings
+func literal(value string) string {
+	value = strings.Replace(value, "'", "''", -1)
+	if strings.Contains(value, `\`) {
+		return fmt.Sprintf("E'%s'", strings.Replace(value, `\`, `\\`, -1))
+	}
+	return fmt.Sprintf("'%s'", value)
+}
+
+// StatementTimeout SET LOCAL statement_timeout
+func (x *Curd) StatementTimeout(timeout time.Duration) *Curd {
+	return x.SetLocal("statement_timeout", milliseconds(timeout))
+}
+
+// LockTimeout SET LOCAL lock_timeout
+func (x *Curd) LockTimeout(timeout time.Duration) *Curd {
+	return x.SetLocal("lock_timeout", milliseconds(timeout))
+}
+
+// IdleInTransactionSessionTimeout SET LOCAL idle_in_transaction_session_timeout
+func (x *Curd) IdleInTransactionSessionTimeout(timeout time.Duration) *Curd {
+	return x.SetLocal("idle_in_transaction_session_timeout", milliseconds(timeout))
+}
+
+// milliseconds Postgres 时间配置的毫秒值, 0 表示不限制
+func milliseconds(d time.Duration) string {
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
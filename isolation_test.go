@@ -0,0 +1,33 @@
+package pg
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSetLocal(t *testing.T) {
+	x := inTx(Table("user")).DryRun()
+	x.SetLocal("work_mem", "64MB").
+		SetLocal("search_path", `it's "a"`).
+		SetLocal("app.path", `C:\tmp`).
+		StatementTimeout(1500 * time.Millisecond).
+		Deferrable()
+	got := []string{}
+	for _, s := range x.Statements() {
+		if len(s.Args) != 0 {
+			t.Errorf("%s: got args %v", s.SQL, s.Args)
+		}
+		got = append(got, s.SQL)
+	}
+	want := []string{
+		`SET LOCAL "work_mem" = '64MB'`,
+		`SET LOCAL "search_path" = 'it''s "a"'`,
+		`SET LOCAL "app.path" = E'C:\\tmp'`,
+		`SET LOCAL "statement_timeout" = '1500ms'`,
+		`SET TRANSACTION DEFERRABLE`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package pg
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Iterator 逐行读取查询结果, 读取完毕或者 Next, Scan 出错时自动关闭, 提前结束读取时必须调用 Close 释放连接
+type Iterator struct {
+	x       *Curd
+	rows    *sql.Rows   // 结果集
+	columns []string    // 结果集的列名
+	e       *QueryEvent // 执行的查询, 关闭时调用钩子的 After
+	count   int64       // 已读取的行数
+	err     error       // 读取过程中的第一个错误
+	closed  bool
+}
+
+// Iterate 执行查询并返回结果集迭代器, 没有调用 Limit 时查询所有匹配的数据
+func (x *Curd) Iterate() *Iterator {
+	defer x.clear()
+	it := &Iterator{x: x}
+	x.ri0()
+	x.error = nil
+	if _, _, err := x.selects(); err != nil {
+		return it.fail(err)
+	}
+	x.operate(OpSelect, x.from())
+	if x.record(x.sql, x.args) {
+		it.closed = true
+		return it
+	}
+	e, err := x.before(x.sql, x.args)
+	if err != nil {
+		return it.fail(err)
+	}
+	rows, err := x.queryContext(e.Context, e.SQL, e.Args)
+	if err != nil {
+		x.after(e, 0, err)
+		return it.fail(err)
+	}
+	it.e = e
+	it.rows = rows
+	return it
+}
+
+// fail 迭代器创建失败
+func (it *Iterator) fail(err error) *Iterator {
+	it.err = err
+	it.closed = true
+	it.x.error = err
+	return it
+}
+
+// Next 准备读取下一行, 没有更多数据或者出错时返回 false 并关闭迭代器
+func (it *Iterator) Next() bool {
+	if it.closed {
+		return false
+	}
+	if it.err == nil && it.rows.Next() {
+		return true
+	}
+	it.Close()
+	return false
+}
+
+// Scan 将当前行映射到 dest, dest 为 *AnyStruct, 列名与字段的对应关系与 Get 相同, 出错时关闭迭代器
+func (it *Iterator) Scan(dest interface{}) error {
+	if it.err != nil {
+		return it.err
+	}
+	if it.closed {
+		return ErrIteratorClosed
+	}
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: scanning a row requires a structure pointer", ErrInvalidResult)
+	}
+	var err error
+	if it.columns == nil {
+		it.columns, err = it.rows.Columns()
+	}
+	var cols []interface{}
+	if err == nil {
+		cols, err = addrs(rv.Elem(), it.columns)
+	}
+	if err == nil {
+		err = it.rows.Scan(cols...)
+	}
+	if err != nil {
+		it.err = err
+		it.Close()
+		return err
+	}
+	it.count++
+	return nil
+}
+
+// Err 读取过程中的错误
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Count 已读取的行数
+func (it *Iterator) Count() int64 {
+	return it.count
+}
+
+// Close 关闭结果集并释放连接, 可以重复调用, 返回读取过程中的错误
+func (it *Iterator) Close() error {
+	if it.closed {
+		return it.err
+	}
+	it.closed = true
+	if err := it.rows.Err(); err != nil && it.err == nil {
+		it.err = err
+	}
+	if err := it.rows.Close(); err != nil && it.err == nil {
+		it.err = err
+	}
+	it.x.after(it.e, it.count, it.err)
+	it.x.error = it.err
+	it.x.rows = it.count
+	return it.err
+}
+
+// Each 逐行读取查询结果, fn 为 func(row *AnyStruct) error, fn 返回错误时停止读取, 该错误作为执行结果
+// 每一行都映射到新的结构体, 没有调用 Limit 时读取所有匹配的数据
+func (x *Curd) Each(fn interface{}) {
+	ft, fv := reflect.TypeOf(fn), reflect.ValueOf(fn)
+	if ft == nil || ft.Kind() != reflect.Func || fv.IsNil() ||
+		ft.NumIn() != 1 || ft.In(0).Kind() != reflect.Ptr || ft.In(0).Elem().Kind() != reflect.Struct ||
+		ft.NumOut() != 1 || ft.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		x.clear()
+		x.ri0()
+		x.error = fmt.Errorf("%w: need a func(row *AnyStruct) error", ErrInvalidResult)
+		return
+	}
+	it := x.Iterate()
+	defer it.Close()
+	for it.Next() {
+		row := reflect.New(ft.In(0).Elem())
+		if it.Scan(row.Interface()) != nil {
+			return
+		}
+		if out := fv.Call([]reflect.Value{row})[0]; !out.IsNil() {
+			it.err = out.Interface().(error)
+			return
+		}
+	}
+}
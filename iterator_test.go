@@ -0,0 +1,70 @@
+package pg
+
+import (
+	"errors"
+	"testing"
+)
+
+type testRow struct {
+	Id   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+// testIdOnly 缺少 name 列对应的字段
+type testIdOnly struct {
+	Id int64 `db:"id"`
+}
+
+func TestIteratorReleasesConnection(t *testing.T) {
+	db, _ := testDB(t.Name())
+	c := NewClient(db)
+
+	it := c.Table("user").Iterate()
+	count := 0
+	for it.Next() {
+		row := testRow{}
+		if err := it.Scan(&row); err != nil {
+			t.Fatal(err)
+		}
+		count++
+	}
+	if count != testRows || it.Err() != nil {
+		t.Fatalf("read %d rows, err %v", count, it.Err())
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Fatalf("%d connections in use after reading all rows", n)
+	}
+
+	// Scan 出错后不调用 Close 也会释放连接
+	it = c.Table("user").Iterate()
+	for it.Next() {
+		if err := it.Scan(&testIdOnly{}); err != nil {
+			break
+		}
+	}
+	var missing *ErrMissingField
+	if !errors.As(it.Err(), &missing) {
+		t.Fatalf("got %v, want *ErrMissingField", it.Err())
+	}
+	if it.Next() {
+		t.Fatal("Next returned true after a scan error")
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Fatalf("%d connections in use after a scan error", n)
+	}
+}
+
+func TestEachStopsOnError(t *testing.T) {
+	db, _ := testDB(t.Name())
+	x := NewClient(db).Table("user")
+	stop := errors.New("stop")
+	x.Each(func(row *testRow) error {
+		return stop
+	})
+	if x.Error() != stop || x.Rows() != 1 {
+		t.Fatalf("got %v, %d rows", x.Error(), x.Rows())
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Fatalf("%d connections in use", n)
+	}
+}
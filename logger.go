@@ -0,0 +1,94 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Logger 记录执行的SQL脚本, 参数, 耗时, 受影响(返回)的行数及错误
+type Logger interface {
+	Log(ctx context.Context, query string, args []interface{}, duration time.Duration, rows int64, err error)
+}
+
+// logger 全局日志, 构造器和客户端都没有指定日志时使用
+var logger Logger
+
+// SetLogger 设置全局日志
+func SetLogger(l Logger) {
+	logger = l
+}
+
+// SetLogger 设置客户端日志, 优先于全局日志
+func (c *Client) SetLogger(l Logger) {
+	c.logger = l
+}
+
+// PrintLogger 输出执行的SQL脚本和对应参数到标准输出
+type PrintLogger struct{}
+
+func (PrintLogger) Log(ctx context.Context, query string, args []interface{}, duration time.Duration, rows int64, err error) {
+	fmt.Println(query, args)
+}
+
+// stdLogger 标准库 log 适配
+type stdLogger struct {
+	logger *log.Logger
+}
+
+// NewStdLogger 使用标准库 *log.Logger 记录SQL, l 为 nil 时使用 log 包默认的 Logger
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{logger: l}
+}
+
+func (s *stdLogger) Log(ctx context.Context, query string, args []interface{}, duration time.Duration, rows int64, err error) {
+	printf := log.Printf
+	if s.logger != nil {
+		printf = s.logger.Printf
+	}
+	if err != nil {
+		printf("%s %v duration=%s rows=%d error=%v", query, args, duration, rows, err)
+		return
+	}
+	printf("%s %v duration=%s rows=%d", query, args, duration, rows)
+}
+
+// KVLogger 键值对风格的日志, 如 *slog.Logger
+type KVLogger interface {
+	Info(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// kvLogger 键值对风格的日志适配
+type kvLogger struct {
+	logger KVLogger
+}
+
+// NewKVLogger 使用键值对风格的日志(如 *slog.Logger)记录SQL
+func NewKVLogger(l KVLogger) Logger {
+	return &kvLogger{logger: l}
+}
+
+func (k *kvLogger) Log(ctx context.Context, query string, args []interface{}, duration time.Duration, rows int64, err error) {
+	if err != nil {
+		k.logger.Error("pg query failed", "sql", query, "args", args, "duration", duration, "rows", rows, "error", err)
+		return
+	}
+	k.logger.Info("pg query", "sql", query, "args", args, "duration", duration, "rows", rows)
+}
+
+// log 记录执行完成的SQL, 优先级: 构造器, 客户端, 全局
+func (x *Curd) log(e *QueryEvent) {
+	l := x.logger
+	if l == nil && x.client != nil {
+		l = x.client.logger
+	}
+	if l == nil {
+		l = logger
+	}
+	if l == nil {
+		return
+	}
+	l.Log(e.Context, e.SQL, e.Args, e.Duration, e.Rows, e.Err)
+}
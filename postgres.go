@@ -1,16 +1,17 @@
 package pg
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"github.com/xooooooox/utils"
 	"reflect"
+	"sort"
 	"strings"
 )
 
 var (
-	idname string = "id" // 主键名称
+	idname string = "id" // 默认主键名称
 	escape string = "\"" // SQL转义字符
 	dollar string = "$"  // SQL占位符
 )
@@ -18,25 +19,46 @@ var (
 var DB *sql.DB
 
 type Curd struct {
-	table  string                 // 查询的表名
-	alias  string                 // 表名别名
-	column string                 // 查询列名
-	update map[string]interface{} // 更新列信息
-	join   string                 // 联合查询
-	where  string                 // 条件语句
-	group  string                 // 分组信息
-	order  string                 // 排序信息
-	limit  int64                  // 查询条数
-	offset int64                  // 跳过的数据条数
-	page   int64                  // 页码
-	dollar int                    // $n SQL占位符序号
-	id     int64                  // 插入一条数据返回的主键值
-	rows   int64                  // 受影响的行数
-	sql    string                 // SQL
-	args   []interface{}          // SQL args
-	error  error                  // error
-	tx     *sql.Tx                // transaction
-	print  bool                   // 是否打印执行的SQL脚本及参数
+	table      string                 // 查询的表名
+	space      string                 // 结构体 Schema() 返回的 schema
+	schema     string                 // 指定的 schema, 优先于结构体的 Schema()
+	alias      string                 // 表名别名
+	column     string                 // 查询列名
+	update     map[string]interface{} // 更新列信息
+	join       string                 // 联合查询
+	where      string                 // 条件语句
+	group      string                 // 分组信息
+	order      string                 // 排序信息
+	limit      int64                  // 查询条数
+	offset     int64                  // 跳过的数据条数
+	page       int64                  // 页码
+	lock       string                 // 行锁子句 FOR UPDATE, FOR SHARE ...
+	returns    string                 // RETURNING 列名
+	result     interface{}            // RETURNING 返回的行映射的结果
+	dollar     int                    // $n SQL占位符序号
+	id         int64                  // 插入一条数据返回的主键值
+	key        interface{}            // 插入一条数据返回的主键值, 复合主键时为 []interface{}
+	rows       int64                  // 受影响的行数
+	conflict   *conflict              // INSERT ... ON CONFLICT
+	inserted   int64                  // ON CONFLICT 实际插入的行数
+	updated    int64                  // ON CONFLICT 冲突后更新的行数
+	sql        string                 // SQL
+	args       []interface{}          // SQL args
+	error      error                  // error
+	tx         *sql.Tx                // transaction
+	stmts      *stmtCache             // 事务中缓存的预处理语句
+	failed     error                  // 事务中第一个执行失败的错误
+	savepoints []savepoint            // 事务中未释放的保存点
+	cursors    int                    // 已声明的游标个数, 用于生成游标名称
+	full       bool                   // 允许不指定条件的 UPDATE, DELETE
+	max        int64                  // UPDATE, DELETE 受影响行数的上限
+	client     *Client                // 所属客户端
+	ctx        context.Context        // 执行SQL使用的上下文
+	logger     Logger                 // 记录执行的SQL, 优先于客户端和全局日志
+	operation  Operation              // 接下来执行的SQL的操作类型
+	target     string                 // 接下来执行的SQL操作的表名
+	dryrun     bool                   // 空运行模式, 只记录SQL不执行
+	statements []Statement            // 空运行模式下记录的SQL
 }
 
 // derive 多种数据类型推算出表名
@@ -111,35 +133,80 @@ func dollars(index int) string {
 }
 
 func Table(table interface{}) *Curd {
-	x := &Curd{}
-	x.table = escaped(derive(table))
-	return x
+	return defaultClient.Table(table)
 }
 
 func Begin() *Curd {
-	x := &Curd{}
-	tx, err := DB.Begin()
-	if err != nil {
-		x.error = err
-		return x
+	return defaultClient.Begin()
+}
+
+// BeginCtx 开启事务, ctx 被取消时 database/sql 会自动回滚该事务
+func BeginCtx(ctx context.Context, opts *sql.TxOptions) *Curd {
+	return defaultClient.BeginCtx(ctx, opts)
+}
+
+// db 当前客户端的数据库连接
+func (x *Curd) db() *sql.DB {
+	if x.client == nil {
+		return defaultClient.DB()
+	}
+	return x.client.DB()
+}
+
+// executor *sql.DB 与 *sql.Tx 共有的执行SQL方法
+type executor interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn 执行SQL使用的连接, 开启了事务时使用事务, 保证事务中的读取可以看到该事务未提交的写入
+func (x *Curd) conn() executor {
+	if x.tx != nil {
+		return x.tx
 	}
-	x.tx = tx
+	return x.db()
+}
+
+// WithContext 设置后续执行SQL使用的上下文
+func (x *Curd) WithContext(ctx context.Context) *Curd {
+	x.ctx = ctx
 	return x
 }
 
+// context 执行SQL使用的上下文, 未设置时为 context.Background()
+func (x *Curd) context() context.Context {
+	if x.ctx == nil {
+		return context.Background()
+	}
+	return x.ctx
+}
+
 func (x *Curd) RollBack() {
 	x.error = x.tx.Rollback()
+	x.closeStmts()
 }
 
 func (x *Curd) Commit() {
 	x.error = x.tx.Commit()
+	x.closeStmts()
 }
 
+// closeStmts 事务结束时释放该事务缓存的预处理语句
+func (x *Curd) closeStmts() {
+	if x.stmts != nil {
+		x.stmts.close()
+		x.stmts = nil
+	}
+}
+
+// Print 使用 PrintLogger 输出执行的SQL脚本及参数, Print(false) 取消输出
 func (x *Curd) Print(print ...bool) *Curd {
-	if len(print) > 0 && x.print != print[0] {
-		x.print = print[0]
+	if len(print) == 0 || print[0] {
+		x.logger = PrintLogger{}
 	} else {
-		x.print = true
+		x.logger = nil
 	}
 	return x
 }
@@ -152,10 +219,25 @@ func (x *Curd) Id() int64 {
 	return x.id
 }
 
+// Key 插入一条数据返回的主键值, 类型与主键字段一致, 复合主键时为 []interface{}
+func (x *Curd) Key() interface{} {
+	return x.key
+}
+
 func (x *Curd) Rows() int64 {
 	return x.rows
 }
 
+// Inserted ON CONFLICT 插入时, 实际插入的行数
+func (x *Curd) Inserted() int64 {
+	return x.inserted
+}
+
+// Updated ON CONFLICT 插入时, 因冲突而更新的行数
+func (x *Curd) Updated() int64 {
+	return x.updated
+}
+
 func (x *Curd) Exec(execute string, args ...interface{}) {
 	var err error
 	var rows int64
@@ -164,66 +246,66 @@ func (x *Curd) Exec(execute string, args ...interface{}) {
 		x.error = err
 		x.rows = rows
 	}()
-	if x.print {
-		fmt.Println(execute, args) // 输出执行的SQL脚本和对应参数
-	}
-	if x.tx != nil {
-		stmt, err := x.tx.Prepare(execute)
-		if err != nil {
-			x.RollBack()
-			return
-		}
-		result, err := stmt.Exec(args...)
-		if err != nil {
-			x.RollBack()
-			return
-		}
-		rows, err = result.RowsAffected()
-		if err != nil {
-			x.RollBack()
-			return
-		}
+	if x.record(execute, args) {
 		return
 	}
-	stmt, err := DB.Prepare(execute)
+	e, err := x.before(execute, args)
 	if err != nil {
 		return
 	}
-	result, err := stmt.Exec(args...)
-	if err != nil {
-		return
+	defer func() {
+		x.after(e, rows, err)
+	}()
+	result, err := x.execContext(e.Context, e.SQL, e.Args)
+	if err == nil {
+		rows, err = result.RowsAffected()
 	}
-	rows, err = result.RowsAffected()
 	if err != nil {
-		return
+		x.abort()
 	}
 	return
 }
 
-func (x *Curd) Add(insert interface{}) {
-	x.ri0()
+// insertion 插入一条数据的SQL, 以及 RETURNING 返回值写入的地址
+type insertion struct {
+	sql      string        // SQL
+	args     []interface{} // SQL args
+	dest     []interface{} // RETURNING 返回值写入的地址, 为空时不需要返回任何数据
+	inserted *bool         // ON CONFLICT 时该行是否为新插入的
+	mapping  *mapping      // 结构体映射信息
+	value    reflect.Value // 插入的结构体
+}
+
+// inserting 构造插入一条数据的SQL
+func (x *Curd) inserting(insert interface{}) (*insertion, error) {
 	if insert == nil {
-		return
+		return nil, ErrNilData
+	}
+	if err := x.conflict.valid(); err != nil {
+		return nil, err
 	}
 	t, v := reflect.TypeOf(insert), reflect.ValueOf(insert)
-	if t.Kind() != reflect.Ptr {
-		return
+	if t.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, ErrNotStructPointer
 	}
 	t, v = t.Elem(), v.Elem()
 	if t.Kind() != reflect.Struct {
-		return
+		return nil, ErrNotStructPointer
 	}
+	m := mapped(t)
 	cols, vals := "", ""
 	args := []interface{}{}
+	columns := []string{}
 	index := 0
 	column := ""
 	sqlInsert := ""
-	for i := 0; i < t.NumField(); i++ {
-		column = utils.PascalToUnderline(t.Field(i).Name)
-		if column == idname {
+	for _, f := range m.fields {
+		column = f.column
+		if !f.insertable(v.FieldByIndex(f.index)) {
 			continue
 		}
-		args = append(args, v.Field(i).Interface())
+		args = append(args, v.FieldByIndex(f.index).Interface())
+		columns = append(columns, column)
 		index++
 		if cols == "" {
 			cols = escaped(column)
@@ -233,117 +315,314 @@ func (x *Curd) Add(insert interface{}) {
 		cols = fmt.Sprintf(`%s, %s`, cols, escaped(column))
 		vals = fmt.Sprintf("%s, %s", vals, dollars(index))
 	}
-	var id int64
+	sqlInsert = fmt.Sprintf(`INSERT INTO %s ( %s ) VALUES ( %s )`, x.named(insert), cols, vals)
+	if x.conflict != nil {
+		clause, conflictArgs := x.conflict.clause(columns, m.keys(), index)
+		sqlInsert = fmt.Sprintf("%s %s", sqlInsert, clause)
+		args = append(args, conflictArgs...)
+	}
+	// 主键值直接写回结构体的主键字段
+	returns := ""
+	dest := []interface{}{}
+	for _, f := range m.pks {
+		dest = append(dest, v.FieldByIndex(f.index).Addr().Interface())
+		if returns == "" {
+			returns = escaped(f.column)
+		} else {
+			returns = fmt.Sprintf("%s, %s", returns, escaped(f.column))
+		}
+	}
+	inserted := true
+	if x.conflict != nil {
+		// xmax = 0 表示该行是新插入的, 否则是冲突后更新的
+		if returns == "" {
+			returns = fmt.Sprintf("( xmax = 0 ) AS %s", escaped("inserted"))
+		} else {
+			returns = fmt.Sprintf("%s, ( xmax = 0 ) AS %s", returns, escaped("inserted"))
+		}
+		dest = append(dest, &inserted)
+	}
+	if returns != "" {
+		sqlInsert = fmt.Sprintf("%s RETURNING %s", sqlInsert, returns)
+	}
+	return &insertion{
+		sql:      sqlInsert,
+		args:     args,
+		dest:     dest,
+		inserted: &inserted,
+		mapping:  m,
+		value:    v,
+	}, nil
+}
+
+func (x *Curd) Add(insert interface{}) {
+	x.ri0()
 	defer func() {
-		x.id = id
+		x.conflict = nil
 	}()
-	sqlInsert = fmt.Sprintf(`INSERT INTO %s ( %s ) VALUES ( %s ) RETURNING %s`, escaped(utils.PascalToUnderline(t.Name())), cols, vals, escaped(idname))
-	if x.print {
-		fmt.Println(sqlInsert, args) // 输出执行的SQL脚本和对应参数
+	in, err := x.inserting(insert)
+	if err != nil {
+		x.error = err
+		return
 	}
-	if x.tx != nil {
-		x.error = x.tx.QueryRow(sqlInsert, args...).Scan(&id)
-		if x.error != nil {
-			x.RollBack()
-		}
+	if len(in.dest) == 0 {
+		// 没有主键, 不需要返回任何数据
+		x.operate(OpInsert, x.named(insert))
+		x.Exec(in.sql, in.args...)
+		return
+	}
+	defer func() {
+		x.error = err
+	}()
+	x.operate(OpInsert, x.named(insert))
+	if x.record(in.sql, in.args) {
+		return
+	}
+	e, err := x.before(in.sql, in.args)
+	if err != nil {
+		return
+	}
+	defer func() {
+		x.after(e, x.rows, err)
+	}()
+	row, err := x.queryRowContext(e.Context, e.SQL, e.Args)
+	if err == nil {
+		err = row.Scan(in.dest...)
+	}
+	if err == sql.ErrNoRows && x.conflict != nil {
+		// DO NOTHING 或者 DO UPDATE ... WHERE 不满足条件, 没有插入也没有更新
+		err = nil
 		return
 	}
-	x.error = DB.QueryRow(sqlInsert, args...).Scan(&id)
+	if err != nil {
+		x.abort()
+		return
+	}
+	x.rows = 1
+	x.key = in.mapping.key(in.value)
+	x.id = in.mapping.id(in.value)
+	if x.conflict != nil {
+		if *in.inserted {
+			x.inserted = 1
+		} else {
+			x.updated = 1
+		}
+	}
 	return
 }
 
-func (x *Curd) Adds(batch ...interface{}) {
-	// 传入当前函数的所有结构体信息
-	type insert struct {
-		Table  string
-		Column string
-		Values string
-		Args   []interface{}
-	}
-	// 需要执行的sql结构体信息
-	type exec struct {
-		Sql  string
-		Args []interface{}
-	}
-	length := len(batch)
-	// 需要插入的数据总条数,每一条的信息
-	inserts := make([]insert, length, length)
-	// 针对每个表的占位符索引
-	sqlIndex := map[string]int{}
-	for i := 0; i < length; i++ {
-		// 不能有空指针
-		if batch[i] == nil {
-			return
+// maxParams 一条SQL最多可以使用的占位符个数
+const maxParams = 65535
+
+// batched 批量插入一张表的一条SQL, 以及该SQL插入的结构体
+type batched struct {
+	Statement
+	columns  []string        // 插入的列名
+	defaults []string        // 至少在一行中使用 DEFAULT 的列名
+	rows     []string        // 每一行的 VALUES
+	values   []reflect.Value // 插入的结构体, 顺序与 VALUES 一致
+	mapping  *mapping        // 结构体映射信息
+}
+
+// defaulted 该列是否已经在某一行中使用了 DEFAULT
+func (b *batched) defaulted(column string) bool {
+	for _, v := range b.defaults {
+		if v == column {
+			return true
 		}
-		t, v := reflect.TypeOf(batch[i]), reflect.ValueOf(batch[i])
-		// 确保参数的每一个参数是指针
-		if t.Kind() != reflect.Ptr {
-			return
+	}
+	return false
+}
+
+// returns 是否需要 RETURNING 子句, 返回主键写回结构体, ON CONFLICT 时区分插入和更新的行数
+func (b *batched) returns(conflict *conflict) bool {
+	return conflict != nil || len(b.mapping.pks) > 0
+}
+
+// batching 构造批量插入的SQL, 按表在 batch 中首次出现的顺序排列, 每个表的占位符超过 maxParams 时拆分为多条SQL
+func (x *Curd) batching(batch ...interface{}) ([]*batched, error) {
+	if err := x.conflict.valid(); err != nil {
+		return nil, err
+	}
+	limit := maxParams
+	if x.conflict != nil {
+		limit -= len(x.conflict.args)
+	}
+	tables := []string{}
+	chunks := map[string][]*batched{}
+	for i, insert := range batch {
+		// 不能有空指针
+		if insert == nil {
+			return nil, fmt.Errorf("element %d: %w", i, ErrNilData)
 		}
-		t, v = t.Elem(), v.Elem()
+		t, v := reflect.TypeOf(insert), reflect.ValueOf(insert)
 		// 确保参数的每一个参数是结构体指针
-		if t.Kind() != reflect.Struct {
-			return
+		if t.Kind() != reflect.Ptr || v.IsNil() || t.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("element %d: %w", i, ErrNotStructPointer)
 		}
+		t, v = t.Elem(), v.Elem()
+		m := mapped(t)
 		// 当前这个结构体的所映射的表名
-		table := utils.PascalToUnderline(t.Name())
-		if _, ok := sqlIndex[table]; !ok {
-			sqlIndex[table] = 1 // 占位符索引从1开始
+		table := x.named(insert)
+		list := chunks[table]
+		if len(list) == 0 {
+			tables = append(tables, table)
+		} else if list[0].mapping != m {
+			return nil, fmt.Errorf("element %d: %s is already inserted from a different structure", i, table)
 		}
-		for j := 0; j < v.NumField(); j++ {
-			// 如果column名称是id 跳过 (主键,自动递增)
-			if utils.PascalToUnderline(t.Field(j).Name) == idname {
+		// 只读字段 跳过
+		fields := make([]*field, 0, len(m.fields))
+		count := 0
+		for _, f := range m.fields {
+			if f.readonly {
 				continue
 			}
-			inserts[i].Table = escaped(table)
-			inserts[i].Args = append(inserts[i].Args, v.Field(j).Interface())
-			if inserts[i].Column == "" {
-				inserts[i].Column = fmt.Sprintf("%s", escaped(utils.PascalToUnderline(t.Field(j).Name)))
-				inserts[i].Values = fmt.Sprintf("%s", dollars(sqlIndex[table]))
-				sqlIndex[table]++
-				continue
+			fields = append(fields, f)
+			if f.insertable(v.FieldByIndex(f.index)) {
+				count++
 			}
-			inserts[i].Column = fmt.Sprintf("%s, %s", inserts[i].Column, escaped(utils.PascalToUnderline(t.Field(j).Name)))
-			inserts[i].Values = fmt.Sprintf("%s, %s", inserts[i].Values, fmt.Sprintf("%s", dollars(sqlIndex[table])))
-			sqlIndex[table]++
-		}
-	}
-	execs := map[string]exec{}
-	for i := 0; i < length; i++ {
-		table := inserts[i].Table
-		if execs[table].Sql == "" {
-			execs[table] = exec{
-				Sql:  fmt.Sprintf("INSERT INTO %s ( %s ) VALUES ( %s )", inserts[i].Table, inserts[i].Column, inserts[i].Values),
-				Args: inserts[i].Args,
+		}
+		var b *batched
+		if len(list) > 0 {
+			b = list[len(list)-1]
+		}
+		if b == nil || len(b.Args)+count > limit {
+			b = &batched{mapping: m}
+			b.Table = table
+			for _, f := range fields {
+				b.columns = append(b.columns, f.column)
 			}
-			continue
+			chunks[table] = append(list, b)
 		}
-		execs[table] = exec{
-			Sql:  fmt.Sprintf("%s, ( %s )", execs[table].Sql, inserts[i].Values),
-			Args: append(execs[table].Args, inserts[i].Args...),
+		// 多行插入的列必须一致, 零值的主键(自动递增)和 omitempty 字段使用 DEFAULT 代替占位符
+		values := ""
+		for _, f := range fields {
+			value := "DEFAULT"
+			if f.insertable(v.FieldByIndex(f.index)) {
+				b.Args = append(b.Args, v.FieldByIndex(f.index).Interface())
+				value = dollars(len(b.Args))
+			} else if !b.defaulted(f.column) {
+				b.defaults = append(b.defaults, f.column)
+			}
+			if values == "" {
+				values = value
+			} else {
+				values = fmt.Sprintf("%s, %s", values, value)
+			}
 		}
+		b.rows = append(b.rows, fmt.Sprintf("( %s )", values))
+		b.values = append(b.values, v)
+	}
+	batches := []*batched{}
+	for _, table := range tables {
+		for _, b := range chunks[table] {
+			columns := ""
+			for _, column := range b.columns {
+				if columns == "" {
+					columns = escaped(column)
+				} else {
+					columns = fmt.Sprintf("%s, %s", columns, escaped(column))
+				}
+			}
+			b.SQL = fmt.Sprintf("INSERT INTO %s ( %s ) VALUES %s", table, columns, strings.Join(b.rows, ", "))
+			if x.conflict != nil {
+				// 与 Add 一致, 省略的列(使用 DEFAULT 的零值 omitempty 字段)冲突时不更新
+				clause, conflictArgs := x.conflict.clause(b.columns, append(b.mapping.keys(), b.defaults...), len(b.Args))
+				b.SQL = fmt.Sprintf("%s %s", b.SQL, clause)
+				b.Args = append(b.Args, conflictArgs...)
+			}
+			if b.returns(x.conflict) {
+				returning := ""
+				for _, f := range b.mapping.pks {
+					if returning == "" {
+						returning = escaped(f.column)
+					} else {
+						returning = fmt.Sprintf("%s, %s", returning, escaped(f.column))
+					}
+				}
+				if x.conflict != nil {
+					// xmax = 0 表示该行是新插入的, 否则是冲突后更新的
+					inserted := fmt.Sprintf("( xmax = 0 ) AS %s", escaped("inserted"))
+					if returning == "" {
+						returning = inserted
+					} else {
+						returning = fmt.Sprintf("%s, %s", returning, inserted)
+					}
+				}
+				b.SQL = fmt.Sprintf("%s RETURNING %s", b.SQL, returning)
+			}
+			batches = append(batches, b)
+		}
+	}
+	return batches, nil
+}
+
+// Adds 批量插入, 结构体有主键时, 返回的主键按顺序写回每一个结构体
+// 出错时停止执行剩余的SQL, 没有开启事务时已经执行的SQL不会撤销
+func (x *Curd) Adds(batch ...interface{}) {
+	defer func() {
+		x.conflict = nil
+	}()
+	batches, err := x.batching(batch...)
+	if err != nil {
+		x.ri0()
+		x.error = err
+		return
 	}
 	var rows int64 // 批量执行插入sql,返回累计受影响的行数
-	for _, val := range execs {
-		x.Exec(val.Sql, val.Args...)
+	var inserted, updated int64
+	for _, b := range batches {
+		x.operate(OpInsert, b.Table)
+		if b.returns(x.conflict) {
+			x.inserts(b)
+			inserted += x.inserted
+			updated += x.updated
+		} else {
+			x.Exec(b.SQL, b.Args...)
+		}
 		rows += x.rows // 受影响的行数递增
+		if x.error != nil {
+			break
+		}
 	}
 	x.rows = rows
+	x.inserted = inserted
+	x.updated = updated
 	return
 }
 
-func (x *Curd) Del() {
-	defer x.clear()
-	x.sql = fmt.Sprintf("DELETE FROM %s", x.table)
+// deleting 构造删除数据的SQL
+func (x *Curd) deleting() (string, []interface{}) {
+	x.sql = fmt.Sprintf("DELETE FROM %s", x.from())
 	if x.where != "" {
 		x.sql = fmt.Sprintf("%s WHERE ( %s )", x.sql, x.where)
 	}
-	x.Exec(x.sql, x.args...)
-	return
+	if x.result != nil {
+		x.sql = fmt.Sprintf("%s RETURNING %s", x.sql, x.returns)
+	}
+	return x.sql, x.args
 }
 
-func (x *Curd) Ups(ups ...map[string]interface{}) {
+// Del 没有指定条件时 Error() 返回 ErrNoWhere, 删除整张表的数据使用 DeleteAll
+func (x *Curd) Del() {
 	defer x.clear()
+	if x.unguarded() {
+		return
+	}
+	x.deleting()
+	x.limited(func() {
+		x.operate(OpDelete, x.from())
+		if x.result != nil {
+			x.returning(x.sql, x.args...)
+			return
+		}
+		x.Exec(x.sql, x.args...)
+	})
+	return
+}
+
+// updating 构造更新数据的SQL, 没有需要更新的列时返回空字符串
+func (x *Curd) updating(ups ...map[string]interface{}) (string, []interface{}) {
 	if x.update == nil {
 		x.update = map[string]interface{}{}
 	}
@@ -356,9 +635,15 @@ func (x *Curd) Ups(ups ...map[string]interface{}) {
 	set := ""
 	x.dollar = 0
 	x.args = []interface{}{}
-	for k, v := range x.update {
+	// 按列名排序, 相同的更新生成相同的SQL, 便于复用预处理语句
+	keys := make([]string, 0, len(x.update))
+	for k := range x.update {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
 		x.dollar++
-		x.args = append(x.args, v)
+		x.args = append(x.args, x.update[k])
 		if set == "" {
 			set = fmt.Sprintf("%s = %s", escaped(k), dollars(x.dollar))
 			continue
@@ -366,44 +651,56 @@ func (x *Curd) Ups(ups ...map[string]interface{}) {
 		set = fmt.Sprintf("%s, %s = %s", set, escaped(k), dollars(x.dollar))
 	}
 	if set == "" {
-		return
+		return "", nil
 	}
-	x.sql = fmt.Sprintf("UPDATE %s SET %s", x.table, set)
+	x.sql = fmt.Sprintf("UPDATE %s SET %s", x.from(), set)
 	if x.where != "" {
-		if strings.Index(x.where, dollars(1)) > 0 {
-			countDollarInWhere := strings.Count(x.where, dollar)
-			for i := 1; i <= countDollarInWhere; i++ {
-				x.dollar++
-				x.where = strings.Replace(x.where, dollars(i), dollars(x.dollar), -1)
-			}
-		}
+		// 条件语句的占位符排在 SET 的占位符之后
+		x.where = renumber(x.where, x.dollar)
+		x.dollar += len(aws)
 		x.sql = fmt.Sprintf("%s WHERE ( %s )", x.sql, x.where)
 	}
 	x.args = append(x.args, aws...)
-	x.Exec(x.sql, x.args...)
-	return
+	if x.result != nil {
+		x.sql = fmt.Sprintf("%s RETURNING %s", x.sql, x.returns)
+	}
+	return x.sql, x.args
 }
 
-// result *AnyStruct LIMIT 1
-// result *[]*AnyStruct LIMIT N, N>1
-func (x *Curd) Get(result interface{}) {
-	var err error
+// Ups 没有指定条件时 Error() 返回 ErrNoWhere, 更新整张表的数据使用 UpdateAll
+func (x *Curd) Ups(ups ...map[string]interface{}) {
 	defer x.clear()
-	defer func() {
-		x.error = err
-	}()
-	rt, rv := reflect.TypeOf(result), reflect.ValueOf(result)
-	kind := rt.Kind()
-	if kind != reflect.Ptr {
-		err = errors.New("need a pointer parameter")
+	if x.unguarded() {
 		return
 	}
-	rt1 := rt.Elem()
-	kind = rt1.Kind()
+	if query, _ := x.updating(ups...); query == "" {
+		return
+	}
+	x.limited(func() {
+		x.operate(OpUpdate, x.from())
+		if x.result != nil {
+			x.returning(x.sql, x.args...)
+			return
+		}
+		x.Exec(x.sql, x.args...)
+	})
+	return
+}
+
+// selecting 构造查询数据的SQL, 没有指定 LIMIT 时默认 LIMIT 1
+func (x *Curd) selecting() (string, []interface{}, error) {
+	if x.limit == 0 {
+		x.limit = 1
+	}
+	return x.selects()
+}
+
+// selects 构造查询数据的SQL, 没有指定 LIMIT 时查询所有匹配的数据
+func (x *Curd) selects() (string, []interface{}, error) {
 	if x.column == "" {
 		x.column = "*"
 	}
-	x.sql = fmt.Sprintf("SELECT %s FROM %s", x.column, x.table)
+	x.sql = fmt.Sprintf("SELECT %s FROM %s", x.column, x.from())
 	if x.alias != "" {
 		x.sql = fmt.Sprintf("%s %s", x.sql, x.alias)
 	}
@@ -419,102 +716,257 @@ func (x *Curd) Get(result interface{}) {
 	if x.order != "" {
 		x.sql = fmt.Sprintf("%s ORDER BY %s", x.sql, x.order)
 	}
-	if x.limit == 0 {
-		x.limit = 1
+	if x.limit > 0 {
+		x.sql = fmt.Sprintf("%s LIMIT %d", x.sql, x.limit)
+		if x.page != 0 {
+			x.offset = (x.page - 1) * x.limit
+		}
+		x.sql = fmt.Sprintf("%s OFFSET %d", x.sql, x.offset)
+	} else if x.offset > 0 {
+		x.sql = fmt.Sprintf("%s OFFSET %d", x.sql, x.offset)
+	}
+	if x.lock != "" {
+		if x.tx == nil {
+			return "", nil, ErrLockWithoutTx
+		}
+		x.sql = fmt.Sprintf("%s %s", x.sql, x.lock)
+	}
+	return x.sql, x.args, nil
+}
+
+// result *AnyStruct LIMIT 1, 没有匹配的数据时 Error() 返回 ErrNotFound
+// result *[]*AnyStruct LIMIT N, N>1
+func (x *Curd) Get(result interface{}) {
+	var err error
+	var found bool
+	defer x.clear()
+	defer func() {
+		if err == nil && !found {
+			err = ErrNotFound
+		}
+		x.error = err
+	}()
+	rt := reflect.TypeOf(result)
+	kind := rt.Kind()
+	if kind != reflect.Ptr {
+		err = ErrNeedPointer
+		return
 	}
-	x.sql = fmt.Sprintf("%s LIMIT %d", x.sql, x.limit)
-	if x.page != 0 {
-		x.offset = (x.page - 1) * x.limit
+	rt1 := rt.Elem()
+	kind = rt1.Kind()
+	_, _, err = x.selecting()
+	if err != nil {
+		return
 	}
-	x.sql = fmt.Sprintf("%s OFFSET %d", x.sql, x.offset)
 	if x.limit == 1 {
 		if kind != reflect.Struct {
-			err = errors.New("querying a piece of data requires structure pointer parameters")
+			err = fmt.Errorf("%w: querying a piece of data requires structure pointer parameters", ErrInvalidResult)
 			return
 		}
 	}
 	if x.limit > 1 {
 		if kind != reflect.Slice {
-			err = errors.New("query multiple data, need slice pointer parameters")
+			err = fmt.Errorf("%w: query multiple data, need slice pointer parameters", ErrInvalidResult)
 			return
 		}
 		rt1 = rt1.Elem()
 		kind = rt1.Kind()
 		if kind != reflect.Ptr {
-			err = errors.New("query multiple data, need to be a pointer inside the slice")
+			err = fmt.Errorf("%w: query multiple data, need to be a pointer inside the slice", ErrInvalidResult)
 			return
 		}
 		rt1 = rt1.Elem()
 		kind = rt1.Kind()
 		if kind != reflect.Struct {
-			err = errors.New("query multiple data, need to be a structure pointer inside the slice")
+			err = fmt.Errorf("%w: query multiple data, need to be a structure pointer inside the slice", ErrInvalidResult)
 			return
 		}
 	}
-	if x.print {
-		fmt.Println(x.sql, x.args) // 输出执行的SQL脚本和对应参数
+	// 查询多条时, 没有匹配的数据不视为错误
+	found = x.limit > 1
+	x.operate(OpSelect, x.from())
+	if x.record(x.sql, x.args) {
+		found = true
+		return
+	}
+	var count int64
+	e, err := x.before(x.sql, x.args)
+	if err != nil {
+		return
 	}
+	defer func() {
+		x.after(e, count, err)
+	}()
 	// 执行查询SQL
-	rows, err := DB.Query(x.sql, x.args...)
+	rows, err := x.queryContext(e.Context, e.SQL, e.Args)
 	if err != nil {
 		return
 	}
+	defer rows.Close()
+	count, err = scan(rows, result)
+	found = found || count > 0
+	return
+}
+
+// orderPrimary 按主键排序查询一条数据, 结构体没有主键时使用默认主键名称
+func (x *Curd) orderPrimary(result interface{}, sort func(name string) *Curd) {
+	columns := []string{idname}
+	rt := reflect.TypeOf(result)
+	if rt != nil && rt.Kind() == reflect.Ptr && rt.Elem().Kind() == reflect.Struct {
+		if pks := mapped(rt.Elem()).pks; len(pks) > 0 {
+			columns = columns[:0]
+			for _, f := range pks {
+				columns = append(columns, f.column)
+			}
+		}
+	}
+	for _, column := range columns {
+		if x.alias != "" {
+			column = fmt.Sprintf("%s.%s", x.alias, escaped(column))
+		}
+		sort(column)
+	}
+	x.Limit(1).Get(result)
+}
+
+// First 按主键升序查询第一条数据
+func (x *Curd) First(result interface{}) {
+	x.orderPrimary(result, x.Asc)
+}
+
+// Last 按主键降序查询最后一条数据
+func (x *Curd) Last(result interface{}) {
+	x.orderPrimary(result, x.Desc)
+}
+
+// Take 不指定排序查询一条数据
+func (x *Curd) Take(result interface{}) {
+	x.Limit(1).Get(result)
+}
+
+// scan 将结果集映射到 result, result 为 *AnyStruct 时读取一行, 为 *[]*AnyStruct 时读取所有行, 返回读取的行数
+func scan(rows *sql.Rows, result interface{}) (count int64, err error) {
 	columns, err := rows.Columns()
 	if err != nil {
 		return
 	}
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr {
+		err = ErrNeedPointer
+		return
+	}
+	data := rv.Elem() // 最终返回的数据
 	// 查询一条
-	if x.limit == 1 {
-		data := rv.Elem()       // 最终返回的数据
-		rzv := reflect.Value{}  // reflect zero value, 反射包零值
-		cols := []interface{}{} // 列名集合
-		for _, cn := range columns {
-			cnv := data.FieldByName(utils.UnderlineToPascal(strings.ToLower(cn))) // 列名全部转换成小写, 下划线命名转帕斯卡命名
-			if cnv == rzv || !cnv.CanSet() {
-				// 结构体缺少cn字段, 或者结构体的cn字段不可访问(小写字母开头)
-				err = errors.New(fmt.Sprintf("structure is missing fields: %s", utils.UnderlineToPascal(cn)))
-				return
-			}
-			cols = append(cols, cnv.Addr().Interface())
+	if data.Kind() == reflect.Struct {
+		cols, err := addrs(data, columns)
+		if err != nil {
+			return count, err
 		}
 		for rows.Next() {
 			err = rows.Scan(cols...)
 			if err != nil {
-				return
+				return count, err
 			}
+			count++
 			break
 		}
-		reflect.ValueOf(result).Elem().Set(data)
-		return
+		return count, rows.Err()
 	}
 	// 查询多条
-	rzv := reflect.Value{} // reflect zero value, 反射包零值
-	data := rv.Elem()      // 最终返回的数据
+	if data.Kind() != reflect.Slice || data.Type().Elem().Kind() != reflect.Ptr || data.Type().Elem().Elem().Kind() != reflect.Struct {
+		err = fmt.Errorf("%w: need a structure pointer or a pointer to a slice of structure pointers", ErrInvalidResult)
+		return
+	}
 	for rows.Next() {
-		row := reflect.New(rt.Elem().Elem().Elem()) // struct
-		rowVal := reflect.Indirect(row)
-		cols := []interface{}{} // 列名集合
-		for _, cn := range columns {
-			cnv := rowVal.FieldByName(utils.UnderlineToPascal(strings.ToLower(cn)))
-			if cnv == rzv || !cnv.CanSet() {
-				// 结构体缺少cn字段, 或者结构体的cn字段不可访问(小写字母开头)
-				err = errors.New(fmt.Sprintf("structure is missing fields: %s", utils.UnderlineToPascal(cn)))
-				return
-			}
-			cols = append(cols, cnv.Addr().Interface())
+		row := reflect.New(data.Type().Elem().Elem()) // struct
+		cols, err := addrs(reflect.Indirect(row), columns)
+		if err != nil {
+			return count, err
 		}
 		err = rows.Scan(cols...)
 		if err != nil {
-			return
+			return count, err
 		}
 		data = reflect.Append(data, row)
+		count++
+	}
+	rv.Elem().Set(data)
+	err = rows.Err()
+	return
+}
+
+// addrs 结构体中与结果集列名对应的字段地址
+func addrs(data reflect.Value, columns []string) ([]interface{}, error) {
+	m := mapped(data.Type())
+	cols := []interface{}{} // 列名集合
+	for _, cn := range columns {
+		f := m.field(cn)
+		if f == nil {
+			// 结构体缺少cn字段, 或者结构体的cn字段不可访问(小写字母开头)
+			return nil, &ErrMissingField{Field: utils.UnderlineToPascal(cn), Column: cn}
+		}
+		cols = append(cols, data.FieldByIndex(f.index).Addr().Interface())
+	}
+	return cols, nil
+}
+
+// Returning Ups, Del 返回受影响的行并映射到 result (*AnyStruct 或 *[]*AnyStruct), 不指定列名时返回所有列
+func (x *Curd) Returning(result interface{}, cols ...string) *Curd {
+	x.result = result
+	x.returns = "*"
+	if len(cols) > 0 {
+		x.returns = ""
+	}
+	for _, v := range cols {
+		v = escapes(v)
+		if x.returns == "" {
+			x.returns = v
+		} else {
+			x.returns = fmt.Sprintf("%s, %s", x.returns, v)
+		}
+	}
+	return x
+}
+
+// returning 执行 UPDATE, DELETE ... RETURNING 并映射返回的行, 返回的行数作为受影响的行数
+func (x *Curd) returning(execute string, args ...interface{}) {
+	var err error
+	var count int64
+	x.ri0()
+	defer func() {
+		x.error = err
+		x.rows = count
+	}()
+	if x.record(execute, args) {
+		return
+	}
+	e, err := x.before(execute, args)
+	if err != nil {
+		return
+	}
+	defer func() {
+		x.after(e, count, err)
+	}()
+	rows, err := x.queryContext(e.Context, e.SQL, e.Args)
+	if err != nil {
+		x.abort()
+		return
+	}
+	defer rows.Close()
+	count, err = scan(rows, x.result)
+	if err != nil {
+		return
 	}
-	reflect.ValueOf(result).Elem().Set(data)
+	// 单行结果只读取了第一行, 继续统计剩余的受影响行数
+	for rows.Next() {
+		count++
+	}
+	err = rows.Err()
 	return
 }
 
 func (x *Curd) Table(table interface{}) *Curd {
-	x.table = escaped(derive(table))
+	x.table, x.space = tabled(table)
 	return x
 }
 
@@ -527,7 +979,7 @@ func (x *Curd) Mod(column string, value interface{}) *Curd {
 }
 
 func (x *Curd) Alias(alias interface{}) *Curd {
-	x.alias = escaped(derive(alias))
+	x.alias, _ = tabled(alias)
 	return x
 }
 
@@ -549,17 +1001,20 @@ func (x *Curd) Join(table interface{}, alias interface{}, col1 string, col2 stri
 }
 
 func (x *Curd) LeftJoin(table interface{}, alias interface{}, col1 string, col2 string) *Curd {
-	x.join = fmt.Sprintf("%s LEFT JOIN %s %s ON %s = %s", x.join, escaped(derive(table)), escaped(derive(alias)), escaped(col1), escaped(col2))
+	name, _ := tabled(alias)
+	x.join = fmt.Sprintf("%s LEFT JOIN %s %s ON %s = %s", x.join, x.named(table), name, escaped(col1), escaped(col2))
 	return x
 }
 
 func (x *Curd) InnerJoin(table interface{}, alias interface{}, col1 string, col2 string) *Curd {
-	x.join = fmt.Sprintf("%s INNER JOIN %s %s ON %s = %s", x.join, escaped(derive(table)), escaped(derive(alias)), escaped(col1), escaped(col2))
+	name, _ := tabled(alias)
+	x.join = fmt.Sprintf("%s INNER JOIN %s %s ON %s = %s", x.join, x.named(table), name, escaped(col1), escaped(col2))
 	return x
 }
 
 func (x *Curd) RightJoin(table interface{}, alias interface{}, col1 string, col2 string) *Curd {
-	x.join = fmt.Sprintf("%s RIGHT JOIN %s %s ON %s = %s", x.join, escaped(derive(table)), escaped(derive(alias)), escaped(col1), escaped(col2))
+	name, _ := tabled(alias)
+	x.join = fmt.Sprintf("%s RIGHT JOIN %s %s ON %s = %s", x.join, x.named(table), name, escaped(col1), escaped(col2))
 	return x
 }
 
@@ -577,11 +1032,9 @@ func (x *Curd) WhereAppend(where string, args ...interface{}) *Curd {
 		return x
 	}
 	if strings.Index(where, dollars(1)) > 0 { // 而且存在 $1, 否则是开发者自己定义, 可能会导致sql执行出错
-		countDollarInWhere := strings.Count(where, dollar)
-		for i := 1; i <= countDollarInWhere; i++ {
-			x.dollar++
-			where = strings.Replace(where, dollars(i), dollars(x.dollar), -1)
-		}
+		// 一次性整体后移, 逐个替换会把 $1 => $2 之后的 $2 再次替换
+		where = renumber(where, x.dollar)
+		x.dollar += len(args)
 	}
 	x.where = fmt.Sprintf("%s %s", x.where, where)
 	x.args = append(x.args, args...)
@@ -845,6 +1298,59 @@ func (x *Curd) Page(page int64) *Curd {
 	return x
 }
 
+// locking 追加行锁子句, of 指定锁定的表名或别名
+func (x *Curd) locking(strength string, of ...string) *Curd {
+	if len(of) > 0 {
+		tables := ""
+		for _, v := range of {
+			if tables == "" {
+				tables = escaped(v)
+			} else {
+				tables = fmt.Sprintf("%s, %s", tables, escaped(v))
+			}
+		}
+		strength = fmt.Sprintf("%s OF %s", strength, tables)
+	}
+	if x.lock == "" {
+		x.lock = strength
+	} else {
+		x.lock = fmt.Sprintf("%s %s", x.lock, strength)
+	}
+	return x
+}
+
+func (x *Curd) ForUpdate(of ...string) *Curd {
+	return x.locking("FOR UPDATE", of...)
+}
+
+func (x *Curd) ForNoKeyUpdate(of ...string) *Curd {
+	return x.locking("FOR NO KEY UPDATE", of...)
+}
+
+func (x *Curd) ForShare(of ...string) *Curd {
+	return x.locking("FOR SHARE", of...)
+}
+
+func (x *Curd) ForKeyShare(of ...string) *Curd {
+	return x.locking("FOR KEY SHARE", of...)
+}
+
+// Nowait 无法立即获取行锁时报错, 作用于最后一个行锁子句
+func (x *Curd) Nowait() *Curd {
+	if x.lock != "" {
+		x.lock = fmt.Sprintf("%s NOWAIT", x.lock)
+	}
+	return x
+}
+
+// SkipLocked 跳过无法立即锁定的行, 作用于最后一个行锁子句
+func (x *Curd) SkipLocked() *Curd {
+	if x.lock != "" {
+		x.lock = fmt.Sprintf("%s SKIP LOCKED", x.lock)
+	}
+	return x
+}
+
 func (x *Curd) clear() {
 	x.alias = ""
 	x.column = ""
@@ -856,6 +1362,12 @@ func (x *Curd) clear() {
 	x.limit = 0
 	x.offset = 0
 	x.page = 0
+	x.lock = ""
+	x.full = false
+	x.max = 0
+	x.conflict = nil
+	x.returns = ""
+	x.result = nil
 	x.dollar = 0
 	x.sql = ""
 	x.args = []interface{}{}
@@ -863,5 +1375,8 @@ func (x *Curd) clear() {
 
 func (x *Curd) ri0() {
 	x.id = 0
+	x.key = nil
 	x.rows = 0
+	x.inserted = 0
+	x.updated = 0
 }
@@ -0,0 +1,118 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// txKey 上下文中保存当前事务的键
+type txKey struct{}
+
+// Context 执行SQL使用的上下文, Transaction 中该上下文携带当前事务, 用于嵌套调用 Transaction
+func (x *Curd) Context() context.Context {
+	return x.context()
+}
+
+// abort 事务中执行出错时回滚整个事务; 存在保存点时不回滚, 由调用方回滚到保存点
+func (x *Curd) abort() {
+	if x.tx != nil && len(x.savepoints) == 0 {
+		x.RollBack()
+	}
+}
+
+// savepoint 事务中建立的保存点
+type savepoint struct {
+	name   string // 保存点名称
+	failed error  // 建立保存点时事务中已经出现的执行错误
+}
+
+// Savepoint SAVEPOINT name
+func (x *Curd) Savepoint(name string) *Curd {
+	if x.tx == nil {
+		x.error = ErrNotInTx
+		return x
+	}
+	x.Exec(fmt.Sprintf("SAVEPOINT %s", quote(name)))
+	if x.error == nil {
+		x.savepoints = append(x.savepoints, savepoint{name: name, failed: x.failed})
+	}
+	return x
+}
+
+// RollbackTo ROLLBACK TO SAVEPOINT name, 撤销该保存点之后的所有操作(包括执行错误), 该保存点仍然保留
+func (x *Curd) RollbackTo(name string) *Curd {
+	if x.tx == nil {
+		x.error = ErrNotInTx
+		return x
+	}
+	x.Exec(fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", quote(name)))
+	if x.error == nil {
+		if i := x.savepoint(name); i < len(x.savepoints) {
+			x.failed = x.savepoints[i].failed
+			x.savepoints = x.savepoints[:i+1]
+		}
+	}
+	return x
+}
+
+// Release RELEASE SAVEPOINT name, 同时释放该保存点之后建立的保存点
+func (x *Curd) Release(name string) *Curd {
+	if x.tx == nil {
+		x.error = ErrNotInTx
+		return x
+	}
+	x.Exec(fmt.Sprintf("RELEASE SAVEPOINT %s", quote(name)))
+	if x.error == nil {
+		x.savepoints = x.savepoints[:x.savepoint(name)]
+	}
+	return x
+}
+
+// savepoint 保存点最后一次建立时的序号
+func (x *Curd) savepoint(name string) int {
+	for i := len(x.savepoints) - 1; i >= 0; i-- {
+		if x.savepoints[i].name == name {
+			return i
+		}
+	}
+	return len(x.savepoints)
+}
+
+// Transaction 已经开启事务时, 使用保存点执行 fn, fn 返回错误或者 panic 时回滚到该保存点; 否则开启新的事务
+// 嵌套执行时 opts 不生效, 也不会重试, 序列化失败等错误由最外层的事务重试
+func (x *Curd) Transaction(ctx context.Context, opts *sql.TxOptions, fn func(tx *Curd) error) (err error) {
+	if x.tx == nil {
+		c := x.client
+		if c == nil {
+			c = defaultClient
+		}
+		return c.Transaction(ctx, opts, fn)
+	}
+	name := fmt.Sprintf("pg_savepoint_%d", len(x.savepoints)+1)
+	if x.Savepoint(name); x.error != nil {
+		return x.error
+	}
+	failed := x.failed
+	rollback := func() {
+		x.RollbackTo(name)
+		x.Release(name)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+	err = fn(x)
+	if err == nil && x.failed != failed {
+		// fn 没有检查的执行错误
+		err = x.failed
+	}
+	if err != nil {
+		rollback()
+		return err
+	}
+	x.Release(name)
+	return x.error
+}
@@ -0,0 +1,153 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/lib/pq"
+	"reflect"
+	"testing"
+)
+
+// testFail 执行 FAIL 时返回唯一约束错误
+func testFail(d *testDriver) {
+	d.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		if query == "FAIL" {
+			return nil, &pq.Error{Code: CodeUniqueViolation}
+		}
+		return driver.RowsAffected(1), nil
+	}
+}
+
+func TestNestedTransactionRollback(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	inner := errors.New("inner")
+	err := c.Transaction(context.Background(), nil, func(tx *Curd) error {
+		tx.Exec("UPDATE 1")
+		// 通过 ctx 嵌套, 使用保存点
+		if err := c.Transaction(tx.Context(), nil, func(tx *Curd) error {
+			tx.Exec("UPDATE 2")
+			if err := tx.Transaction(context.Background(), nil, func(tx *Curd) error {
+				tx.Exec("UPDATE 3")
+				return nil
+			}); err != nil {
+				return err
+			}
+			return inner
+		}); err != inner {
+			t.Errorf("got %v, want inner", err)
+		}
+		tx.Exec("UPDATE 4")
+		return tx.Error()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"BEGIN",
+		"UPDATE 1",
+		`SAVEPOINT "pg_savepoint_1"`,
+		"UPDATE 2",
+		`SAVEPOINT "pg_savepoint_2"`,
+		"UPDATE 3",
+		`RELEASE SAVEPOINT "pg_savepoint_2"`,
+		`ROLLBACK TO SAVEPOINT "pg_savepoint_1"`,
+		`RELEASE SAVEPOINT "pg_savepoint_1"`,
+		"UPDATE 4",
+		"COMMIT",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestNestedTransactionFailed(t *testing.T) {
+	db, d := testDB(t.Name())
+	testFail(d)
+	err := NewClient(db).Transaction(context.Background(), nil, func(tx *Curd) error {
+		// 没有检查的执行错误作为嵌套事务的结果, 回滚到保存点之后不再影响外层事务
+		err := tx.Transaction(context.Background(), nil, func(tx *Curd) error {
+			tx.Exec("FAIL")
+			return nil
+		})
+		if Code(err) != CodeUniqueViolation {
+			t.Errorf("got %v", err)
+		}
+		if tx.failed != nil {
+			t.Errorf("failed %v after rolling back to the savepoint", tx.failed)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"BEGIN",
+		`SAVEPOINT "pg_savepoint_1"`,
+		"FAIL",
+		`ROLLBACK TO SAVEPOINT "pg_savepoint_1"`,
+		`RELEASE SAVEPOINT "pg_savepoint_1"`,
+		"COMMIT",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestRollbackToRestoresFailed(t *testing.T) {
+	db, d := testDB(t.Name())
+	testFail(d)
+	tx := NewClient(db).Begin()
+	tx.Savepoint("a")
+	tx.Exec("FAIL")
+	failed := tx.failed
+	tx.Savepoint("b")
+	tx.Exec("FAIL")
+	if tx.RollbackTo("b"); tx.failed != failed {
+		t.Errorf("got %v, want the error before savepoint b", tx.failed)
+	}
+	if tx.RollbackTo("a"); tx.failed != nil {
+		t.Errorf("got %v, want nil", tx.failed)
+	}
+	if tx.Release("a"); len(tx.savepoints) != 0 {
+		t.Errorf("%d savepoints left", len(tx.savepoints))
+	}
+	tx.Commit()
+	if tx.Error() != nil {
+		t.Fatal(tx.Error())
+	}
+}
+
+func TestAbort(t *testing.T) {
+	db, d := testDB(t.Name())
+	testFail(d)
+	c := NewClient(db)
+
+	// 存在保存点时由调用方回滚到保存点, 事务不回滚
+	tx := c.Begin()
+	tx.Savepoint("a")
+	tx.Exec("FAIL")
+	tx.RollbackTo("a")
+	tx.Commit()
+	if tx.Error() != nil {
+		t.Fatal(tx.Error())
+	}
+
+	// 没有保存点时执行出错回滚事务
+	tx = c.Begin()
+	tx.Exec("FAIL")
+	if Code(tx.Error()) != CodeUniqueViolation {
+		t.Errorf("got %v", tx.Error())
+	}
+	want := []string{
+		"BEGIN", `SAVEPOINT "a"`, "FAIL", `ROLLBACK TO SAVEPOINT "a"`, "COMMIT",
+		"BEGIN", "FAIL", "ROLLBACK",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("%d connections in use", n)
+	}
+}
@@ -0,0 +1,126 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SlowQuery 执行耗时超过阈值的SQL
+type SlowQuery struct {
+	Operation Operation     // 操作类型
+	Table     string        // 操作的表名
+	SQL       string        // SQL
+	Args      []interface{} // SQL args
+	Start     time.Time     // 开始执行的时间
+	Duration  time.Duration // 执行耗时
+	Rows      int64         // 受影响(返回)的行数
+	Err       error         // 执行错误
+	Plan      string        // EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) 的执行计划
+	PlanErr   error         // 获取执行计划的错误
+}
+
+// SlowQueryOptions 慢查询配置
+type SlowQueryOptions struct {
+	Threshold time.Duration                           // 执行耗时达到该值时报告, 为 0 时不检测
+	Explain   bool                                    // 是否在回滚的事务中重新执行 EXPLAIN ANALYZE 获取执行计划
+	Report    func(ctx context.Context, q *SlowQuery) // 报告慢查询, 为 nil 时使用标准库 log 输出
+}
+
+// slowQuery 全局慢查询配置, 客户端没有配置时使用
+var slowQuery *SlowQueryOptions
+
+// SetSlowQuery 设置全局慢查询配置
+func SetSlowQuery(opts *SlowQueryOptions) {
+	slowQuery = opts
+}
+
+// SetSlowQuery 设置客户端慢查询配置, 优先于全局配置
+func (c *Client) SetSlowQuery(opts *SlowQueryOptions) {
+	c.slow = opts
+}
+
+// slow 执行耗时超过阈值时报告慢查询
+func (x *Curd) slow(e *QueryEvent) {
+	opts := slowQuery
+	if x.client != nil && x.client.slow != nil {
+		opts = x.client.slow
+	}
+	if opts == nil || opts.Threshold <= 0 || e.Duration < opts.Threshold {
+		return
+	}
+	q := &SlowQuery{
+		Operation: e.Operation,
+		Table:     e.Table,
+		SQL:       e.SQL,
+		Args:      e.Args,
+		Start:     e.Start,
+		Duration:  e.Duration,
+		Rows:      e.Rows,
+		Err:       e.Err,
+	}
+	if opts.Explain && e.Err == nil {
+		q.Plan, q.PlanErr = x.explain(e.Context, e.SQL, e.Args)
+	}
+	if opts.Report != nil {
+		opts.Report(e.Context, q)
+		return
+	}
+	if q.Plan != "" {
+		log.Printf("slow query %s: %s %v plan: %s", q.Duration, q.SQL, q.Args, q.Plan)
+		return
+	}
+	log.Printf("slow query %s: %s %v", q.Duration, q.SQL, q.Args)
+}
+
+// explain 重新执行SQL获取执行计划, 执行结果总是会被回滚
+// 事务中使用保存点, 以便看到该事务未提交的数据并且不与该事务持有的锁冲突; 否则使用单独的事务
+func (x *Curd) explain(ctx context.Context, query string, args []interface{}) (plan string, err error) {
+	query = fmt.Sprintf("EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) %s", query)
+	if x.tx != nil {
+		savepoint := escaped("pg_explain")
+		if _, err = x.tx.ExecContext(ctx, fmt.Sprintf("SAVEPOINT %s", savepoint)); err != nil {
+			return
+		}
+		defer func() {
+			_, rollback := x.tx.ExecContext(ctx, fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", savepoint))
+			if rollback == nil {
+				_, rollback = x.tx.ExecContext(ctx, fmt.Sprintf("RELEASE SAVEPOINT %s", savepoint))
+			}
+			if err == nil {
+				err = rollback
+			}
+		}()
+		return plans(ctx, x.tx, query, args)
+	}
+	tx, err := x.db().BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	return plans(ctx, tx, query, args)
+}
+
+// plans 读取 EXPLAIN 返回的执行计划
+func plans(ctx context.Context, tx *sql.Tx, query string, args []interface{}) (string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	lines := []string{}
+	line := ""
+	for rows.Next() {
+		if err = rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
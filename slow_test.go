@@ -0,0 +1,103 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testSlow 每次执行耗时 1ms, EXPLAIN 返回一行执行计划
+func testSlow(d *testDriver) {
+	d.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		time.Sleep(time.Millisecond)
+		return driver.RowsAffected(2), nil
+	}
+	d.query = func(query string, args []driver.Value) (driver.Rows, error) {
+		return &testTable{columns: []string{"QUERY PLAN"}, values: [][]driver.Value{{"[plan]"}}}, nil
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	defer func(saved *SlowQueryOptions) {
+		slowQuery = saved
+	}(slowQuery)
+	db, d := testDB(t.Name())
+	testSlow(d)
+	c := NewClient(db)
+	reported := []*SlowQuery{}
+	report := func(ctx context.Context, q *SlowQuery) {
+		reported = append(reported, q)
+	}
+
+	// 客户端配置优先于全局配置
+	SetSlowQuery(&SlowQueryOptions{Threshold: time.Millisecond, Report: report})
+	c.SetSlowQuery(&SlowQueryOptions{Threshold: time.Hour, Report: report})
+	c.Table("user").Exec("UPDATE")
+	c.SetSlowQuery(&SlowQueryOptions{Report: report})
+	c.Table("user").Exec("UPDATE")
+	if len(reported) != 0 {
+		t.Fatalf("reported %d queries", len(reported))
+	}
+
+	c.SetSlowQuery(&SlowQueryOptions{Threshold: time.Millisecond, Report: report})
+	c.Table("user").WhereEqual("id", 1).Del()
+	if len(reported) != 1 {
+		t.Fatalf("reported %d queries", len(reported))
+	}
+	q := reported[0]
+	if q.Operation != OpDelete || q.SQL != `DELETE FROM "user" WHERE ( "id" = $1 )` || q.Rows != 2 || q.Duration < time.Millisecond || q.Plan != "" {
+		t.Errorf("got %+v", q)
+	}
+	if got, want := d.logged(), []string{"UPDATE", "UPDATE", `DELETE FROM "user" WHERE ( "id" = $1 )`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestSlowQueryExplain(t *testing.T) {
+	db, d := testDB(t.Name())
+	testSlow(d)
+	c := NewClient(db)
+	reported := []*SlowQuery{}
+	c.SetSlowQuery(&SlowQueryOptions{Threshold: time.Millisecond, Explain: true, Report: func(ctx context.Context, q *SlowQuery) {
+		reported = append(reported, q)
+	}})
+
+	// 没有开启事务时在单独的事务中执行并回滚
+	c.Table("user").Exec("UPDATE")
+	want := []string{"UPDATE", "BEGIN", "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) UPDATE", "ROLLBACK"}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	// 事务中回滚到保存点, 事务仍然可以提交
+	d.log = nil
+	err := c.Transaction(context.Background(), nil, func(tx *Curd) error {
+		tx.Exec("UPDATE")
+		return tx.Error()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"BEGIN",
+		"UPDATE",
+		`SAVEPOINT "pg_explain"`,
+		"EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) UPDATE",
+		`ROLLBACK TO SAVEPOINT "pg_explain"`,
+		`RELEASE SAVEPOINT "pg_explain"`,
+		"COMMIT",
+	}
+	if got := d.logged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if len(reported) != 2 {
+		t.Fatalf("reported %d queries", len(reported))
+	}
+	for _, q := range reported {
+		if q.Plan != "[plan]" || q.PlanErr != nil {
+			t.Errorf("got plan %q, %v", q.Plan, q.PlanErr)
+		}
+	}
+}
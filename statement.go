@@ -0,0 +1,85 @@
+package pg
+
+// Statement 构造出的SQL及其参数
+type Statement struct {
+	Table string // 操作的表名
+	SQL   string
+	Args  []interface{}
+}
+
+// DryRun 空运行模式, 只记录将要执行的SQL, 不发送到数据库, 通过 Statements() 获取
+func (x *Curd) DryRun(dry ...bool) *Curd {
+	x.dryrun = len(dry) == 0 || dry[0]
+	return x
+}
+
+// Statements 空运行模式下记录的所有SQL
+func (x *Curd) Statements() []Statement {
+	return x.statements
+}
+
+// record 空运行模式下记录SQL, 返回 true 表示不需要执行该SQL
+func (x *Curd) record(query string, args []interface{}) bool {
+	if !x.dryrun {
+		return false
+	}
+	x.statements = append(x.statements, Statement{Table: x.target, SQL: query, Args: args})
+	x.operate("", "")
+	return true
+}
+
+// GetSQL 构造 Get 执行的查询SQL, 不访问数据库
+func (x *Curd) GetSQL() (string, []interface{}, error) {
+	defer x.clear()
+	return x.selecting()
+}
+
+// AddSQL 构造 Add 执行的插入SQL, 不访问数据库
+func (x *Curd) AddSQL(insert interface{}) (string, []interface{}, error) {
+	defer func() {
+		x.conflict = nil
+	}()
+	in, err := x.inserting(insert)
+	if err != nil {
+		return "", nil, err
+	}
+	return in.sql, in.args, nil
+}
+
+// AddsSQL 构造 Adds 执行的批量插入SQL, 不访问数据库; 每个表对应一条SQL, 占位符超过 65535 个时拆分为多条
+func (x *Curd) AddsSQL(batch ...interface{}) ([]Statement, error) {
+	defer func() {
+		x.conflict = nil
+	}()
+	batches, err := x.batching(batch...)
+	if err != nil {
+		return nil, err
+	}
+	statements := make([]Statement, 0, len(batches))
+	for _, b := range batches {
+		statements = append(statements, b.Statement)
+	}
+	return statements, nil
+}
+
+// UpsSQL 构造 Ups 执行的更新SQL, 不访问数据库; 没有需要更新的列时返回空字符串
+// 与 Ups 相同, 没有指定条件且没有调用 AllowFullTable 时返回 ErrNoWhere
+func (x *Curd) UpsSQL(ups ...map[string]interface{}) (string, []interface{}, error) {
+	defer x.clear()
+	if x.unguarded() {
+		return "", nil, x.error
+	}
+	query, args := x.updating(ups...)
+	return query, args, nil
+}
+
+// DelSQL 构造 Del 执行的删除SQL, 不访问数据库
+// 与 Del 相同, 没有指定条件且没有调用 AllowFullTable 时返回 ErrNoWhere
+func (x *Curd) DelSQL() (string, []interface{}, error) {
+	defer x.clear()
+	if x.unguarded() {
+		return "", nil, x.error
+	}
+	query, args := x.deleting()
+	return query, args, nil
+}
@@ -0,0 +1,381 @@
+package pg
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+type testUser struct {
+	Id    int64  `db:"id"`
+	Email string `db:"email"`
+	Name  string `db:"name,omitempty"`
+}
+
+func (testUser) TableName() string {
+	return "user"
+}
+
+func TestAddsSQLConflict(t *testing.T) {
+	tests := []struct {
+		name  string
+		curd  func() *Curd
+		batch []interface{}
+		sql   []string
+	}{
+		{
+			name: "do update skips primary key",
+			curd: func() *Curd {
+				return Table("user").OnConflict("email").DoUpdate()
+			},
+			batch: []interface{}{&testUser{Email: "a", Name: "a"}, &testUser{Email: "b", Name: "b"}},
+			sql: []string{
+				`INSERT INTO "user" ( "id", "email", "name" ) VALUES ( DEFAULT, $1, $2 ), ( DEFAULT, $3, $4 ) ON CONFLICT ( "email" ) DO UPDATE SET "name" = EXCLUDED."name" RETURNING "id", ( xmax = 0 ) AS "inserted"`,
+			},
+		},
+		{
+			name: "omitempty column sent as DEFAULT is not updated",
+			curd: func() *Curd {
+				return Table("user").OnConflict("email").DoUpdate()
+			},
+			batch: []interface{}{&testUser{Email: "a", Name: "a"}, &testUser{Email: "b"}},
+			sql: []string{
+				`INSERT INTO "user" ( "id", "email", "name" ) VALUES ( DEFAULT, $1, $2 ), ( DEFAULT, $3, DEFAULT ) ON CONFLICT ( "email" ) DO NOTHING RETURNING "id", ( xmax = 0 ) AS "inserted"`,
+			},
+		},
+		{
+			name: "explicit primary key is still not updated",
+			curd: func() *Curd {
+				return Table("user").OnConflict("email").DoUpdate()
+			},
+			batch: []interface{}{&testUser{Id: 1, Email: "a", Name: "a"}},
+			sql: []string{
+				`INSERT INTO "user" ( "id", "email", "name" ) VALUES ( $1, $2, $3 ) ON CONFLICT ( "email" ) DO UPDATE SET "name" = EXCLUDED."name" RETURNING "id", ( xmax = 0 ) AS "inserted"`,
+			},
+		},
+		{
+			name: "explicit update columns are kept",
+			curd: func() *Curd {
+				return Table("user").OnConflict("email").DoUpdate("id", "name")
+			},
+			batch: []interface{}{&testUser{Id: 1, Email: "a", Name: "a"}},
+			sql: []string{
+				`INSERT INTO "user" ( "id", "email", "name" ) VALUES ( $1, $2, $3 ) ON CONFLICT ( "email" ) DO UPDATE SET "id" = EXCLUDED."id", "name" = EXCLUDED."name" RETURNING "id", ( xmax = 0 ) AS "inserted"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements, err := tt.curd().AddsSQL(tt.batch...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sqls := []string{}
+			for _, s := range statements {
+				sqls = append(sqls, s.SQL)
+			}
+			if !reflect.DeepEqual(sqls, tt.sql) {
+				t.Errorf("got  %q\nwant %q", sqls, tt.sql)
+			}
+		})
+	}
+}
+
+func TestAddSQLConflict(t *testing.T) {
+	query, args, err := Table("user").OnConflict("email").DoUpdate().AddSQL(&testUser{Id: 1, Email: "a", Name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO "user" ( "id", "email", "name" ) VALUES ( $1, $2, $3 ) ON CONFLICT ( "email" ) DO UPDATE SET "name" = EXCLUDED."name" RETURNING "id", ( xmax = 0 ) AS "inserted"`
+	if query != want {
+		t.Errorf("got  %s\nwant %s", query, want)
+	}
+	if len(args) != 3 {
+		t.Errorf("got %d args, want 3", len(args))
+	}
+}
+
+func TestAddSQLConflictOmitempty(t *testing.T) {
+	query, _, err := Table("user").OnConflict("email").DoUpdate().AddSQL(&testUser{Email: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO "user" ( "email" ) VALUES ( $1 ) ON CONFLICT ( "email" ) DO NOTHING RETURNING "id", ( xmax = 0 ) AS "inserted"`
+	if query != want {
+		t.Errorf("got  %s\nwant %s", query, want)
+	}
+}
+
+func TestConflictWithoutTarget(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	renders := map[string]func() error{
+		"AddSQL": func() error {
+			_, _, err := Table("user").DoUpdate().AddSQL(&testUser{Email: "a"})
+			return err
+		},
+		"AddsSQL": func() error {
+			_, err := Table("user").ConflictWhere("1 = 1").AddsSQL(&testUser{Email: "a"})
+			return err
+		},
+		"Add": func() error {
+			x := c.Table("user").DoUpdate("email")
+			x.Add(&testUser{Email: "a"})
+			return x.Error()
+		},
+		"Adds": func() error {
+			x := c.Table("user").DoUpdate()
+			x.Adds(&testUser{Email: "a"})
+			return x.Error()
+		},
+	}
+	for name, render := range renders {
+		if err := render(); err != ErrConflictTarget {
+			t.Errorf("%s: got %v, want ErrConflictTarget", name, err)
+		}
+	}
+	if got := d.logged(); len(got) != 0 {
+		t.Errorf("executed %q", got)
+	}
+	// DO NOTHING 可以不指定冲突目标
+	query, _, err := Table("user").DoNothing().AddSQL(&testUser{Email: "a"})
+	if err != nil || query != `INSERT INTO "user" ( "email" ) VALUES ( $1 ) ON CONFLICT DO NOTHING RETURNING "id", ( xmax = 0 ) AS "inserted"` {
+		t.Errorf("got %s, %v", query, err)
+	}
+}
+
+type testInvoice struct {
+	Id    int64 `db:"id"`
+	Total int64 `db:"total"`
+}
+
+func (testInvoice) TableName() string {
+	return "invoice"
+}
+
+func (testInvoice) Schema() string {
+	return "billing"
+}
+
+// inTx 模拟事务中的 Curd, 只用于构造SQL, 不会执行
+func inTx(x *Curd) *Curd {
+	x.tx = &sql.Tx{}
+	return x
+}
+
+func TestToSQL(t *testing.T) {
+	type render func() (string, []interface{}, error)
+	tests := []struct {
+		name   string
+		render render
+		sql    string
+		args   []interface{}
+		err    error
+	}{
+		{
+			name:   "renumber where append",
+			render: Table("user").WhereEqual("id", 1).WhereAppend("AND ( name = $1 OR email = $2 )", "n", "e").GetSQL,
+			sql:    `SELECT * FROM "user" WHERE ( "id" = $1 AND ( name = $2 OR email = $3 ) ) LIMIT 1 OFFSET 0`,
+			args:   []interface{}{1, "n", "e"},
+		},
+		{
+			name: "renumber where after set",
+			render: func() (string, []interface{}, error) {
+				return Table("user").WhereEqual("id", 1).WhereAppend("AND ( name = $1 OR email = $2 )", "n", "e").Mod("name", "x").Mod("email", "y").UpsSQL()
+			},
+			sql:  `UPDATE "user" SET "email" = $1, "name" = $2 WHERE ( "id" = $3 AND ( name = $4 OR email = $5 ) )`,
+			args: []interface{}{"y", "x", 1, "n", "e"},
+		},
+		{
+			name: "renumber raw where after set",
+			render: func() (string, []interface{}, error) {
+				return Table("user").Where("id = $1 AND name = $2", 1, "n").Mod("name", "x").UpsSQL()
+			},
+			sql:  `UPDATE "user" SET "name" = $1 WHERE ( id = $2 AND name = $3 )`,
+			args: []interface{}{"x", 1, "n"},
+		},
+		{
+			name:   "delete",
+			render: Table("user").WhereIn("id", 1, 2).DelSQL,
+			sql:    `DELETE FROM "user" WHERE ( "id" IN ( $1, $2 ) )`,
+			args:   []interface{}{1, 2},
+		},
+		{
+			name:   "schema from struct",
+			render: Table(&testInvoice{}).WhereEqual("id", 1).GetSQL,
+			sql:    `SELECT * FROM "billing"."invoice" WHERE ( "id" = $1 ) LIMIT 1 OFFSET 0`,
+			args:   []interface{}{1},
+		},
+		{
+			name:   "schema override",
+			render: Table(&testInvoice{}).Schema("tenant").WhereEqual("id", 1).DelSQL,
+			sql:    `DELETE FROM "tenant"."invoice" WHERE ( "id" = $1 )`,
+			args:   []interface{}{1},
+		},
+		{
+			name: "schema on insert",
+			render: func() (string, []interface{}, error) {
+				return Table(&testInvoice{}).AddSQL(&testInvoice{Total: 3})
+			},
+			sql:  `INSERT INTO "billing"."invoice" ( "total" ) VALUES ( $1 ) RETURNING "id"`,
+			args: []interface{}{int64(3)},
+		},
+		{
+			name: "on conflict do nothing",
+			render: func() (string, []interface{}, error) {
+				return Table("user").OnConflict("email").DoNothing().AddSQL(&testUser{Email: "a"})
+			},
+			sql:  `INSERT INTO "user" ( "email" ) VALUES ( $1 ) ON CONFLICT ( "email" ) DO NOTHING RETURNING "id", ( xmax = 0 ) AS "inserted"`,
+			args: []interface{}{"a"},
+		},
+		{
+			name: "on constraint do update",
+			render: func() (string, []interface{}, error) {
+				return Table("user").OnConstraint("user_email_key").DoUpdate("name").AddSQL(&testUser{Email: "a", Name: "n"})
+			},
+			sql:  `INSERT INTO "user" ( "email", "name" ) VALUES ( $1, $2 ) ON CONFLICT ON CONSTRAINT "user_email_key" DO UPDATE SET "name" = EXCLUDED."name" RETURNING "id", ( xmax = 0 ) AS "inserted"`,
+			args: []interface{}{"a", "n"},
+		},
+		{
+			name: "on conflict where",
+			render: func() (string, []interface{}, error) {
+				return Table("user").OnConflict("email").DoUpdate().ConflictWhere(`"user".name <> $1`, "x").AddSQL(&testUser{Email: "a", Name: "n"})
+			},
+			sql:  `INSERT INTO "user" ( "email", "name" ) VALUES ( $1, $2 ) ON CONFLICT ( "email" ) DO UPDATE SET "name" = EXCLUDED."name" WHERE ( "user".name <> $3 ) RETURNING "id", ( xmax = 0 ) AS "inserted"`,
+			args: []interface{}{"a", "n", "x"},
+		},
+		{
+			name:   "lock without transaction",
+			render: Table("user").WhereEqual("id", 1).ForUpdate().GetSQL,
+			err:    ErrLockWithoutTx,
+		},
+		{
+			name:   "for update of skip locked",
+			render: inTx(Table("user")).WhereEqual("id", 1).ForUpdate("user").SkipLocked().GetSQL,
+			sql:    `SELECT * FROM "user" WHERE ( "id" = $1 ) LIMIT 1 OFFSET 0 FOR UPDATE OF "user" SKIP LOCKED`,
+			args:   []interface{}{1},
+		},
+		{
+			name:   "for share nowait",
+			render: inTx(Table("user")).WhereEqual("id", 1).ForShare().Nowait().GetSQL,
+			sql:    `SELECT * FROM "user" WHERE ( "id" = $1 ) LIMIT 1 OFFSET 0 FOR SHARE NOWAIT`,
+			args:   []interface{}{1},
+		},
+		{
+			name:   "for no key update",
+			render: inTx(Table("user")).WhereEqual("id", 1).ForNoKeyUpdate().GetSQL,
+			sql:    `SELECT * FROM "user" WHERE ( "id" = $1 ) LIMIT 1 OFFSET 0 FOR NO KEY UPDATE`,
+			args:   []interface{}{1},
+		},
+		{
+			name:   "for key share",
+			render: inTx(Table("user")).WhereEqual("id", 1).ForKeyShare().GetSQL,
+			sql:    `SELECT * FROM "user" WHERE ( "id" = $1 ) LIMIT 1 OFFSET 0 FOR KEY SHARE`,
+			args:   []interface{}{1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := tt.render()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if query != tt.sql {
+				t.Errorf("got  %s\nwant %s", query, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got args %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	tests := []struct {
+		s      string
+		offset int
+		want   string
+	}{
+		{"a = $1", 0, "a = $1"},
+		{"a = $1 AND b = $2", 2, "a = $3 AND b = $4"},
+		{"a = $1 OR a = $1", 1, "a = $2 OR a = $2"},
+		{"a = $9 AND b = $10", 1, "a = $10 AND b = $11"},
+		{"a = '$' AND b = $1", 3, "a = '$' AND b = $4"},
+	}
+	for _, tt := range tests {
+		if got := renumber(tt.s, tt.offset); got != tt.want {
+			t.Errorf("renumber(%q, %d) = %q, want %q", tt.s, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestAddsSQLChunk(t *testing.T) {
+	placeholder := regexp.MustCompile(`\$(\d+)`)
+	tests := []struct {
+		name  string
+		curd  func() *Curd
+		rows  int
+		want  []int // 每条SQL的参数个数
+		extra int   // 每条SQL末尾的 ConflictWhere 参数个数
+	}{
+		{
+			name: "exactly the limit",
+			curd: func() *Curd { return Table("user") },
+			rows: maxParams / 2,
+			want: []int{65534},
+		},
+		{
+			name: "crosses the limit",
+			curd: func() *Curd { return Table("user") },
+			rows: 40000,
+			want: []int{65534, 14466},
+		},
+		{
+			name:  "conflict where arguments count against the limit",
+			curd:  func() *Curd { return Table("user").OnConflict("email").DoUpdate().ConflictWhere("$1 < $2", 1, 2) },
+			rows:  40000,
+			want:  []int{65534, 14470},
+			extra: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batch := make([]interface{}, tt.rows)
+			for i := range batch {
+				batch[i] = &testUser{Email: "a", Name: "n"}
+			}
+			statements, err := tt.curd().AddsSQL(batch...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(statements) != len(tt.want) {
+				t.Fatalf("got %d statements, want %d", len(statements), len(tt.want))
+			}
+			rows := 0
+			for i, s := range statements {
+				if len(s.Args) != tt.want[i] || len(s.Args) > maxParams {
+					t.Errorf("statement %d: got %d args, want %d", i, len(s.Args), tt.want[i])
+				}
+				// 每条SQL的占位符都从 $1 开始连续编号
+				seen := map[int]bool{}
+				for _, m := range placeholder.FindAllStringSubmatch(s.SQL, -1) {
+					n, _ := strconv.Atoi(m[1])
+					seen[n] = true
+				}
+				if len(seen) != len(s.Args) || !seen[1] || !seen[len(s.Args)] {
+					t.Errorf("statement %d: %d distinct placeholders for %d args", i, len(seen), len(s.Args))
+				}
+				rows += (len(s.Args) - tt.extra) / 2
+			}
+			if rows != tt.rows {
+				t.Errorf("got %d rows, want %d", rows, tt.rows)
+			}
+		})
+	}
+}
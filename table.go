@@ -0,0 +1,79 @@
+package pg
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// TableNamer 结构体实现该接口时, 使用返回值作为表名, 不做任何大小写转换
+type TableNamer interface {
+	TableName() string
+}
+
+// SchemaNamer 结构体实现该接口时, 使用返回值作为表所在的 schema
+type SchemaNamer interface {
+	Schema() string
+}
+
+// implements 结构体值或者结构体指针是否实现了接口, 返回实现了接口的值
+func implements(table interface{}) interface{} {
+	if table == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(table)
+	if rv.Kind() == reflect.Struct {
+		// 指针接收者的方法, 需要取结构体的指针
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return ptr.Interface()
+	}
+	return table
+}
+
+// tabled 推算转义后的表名及其 schema, 优先使用 TableNamer, SchemaNamer 接口的返回值
+func tabled(table interface{}) (name string, schema string) {
+	model := implements(table)
+	if n, ok := model.(TableNamer); ok {
+		name = quote(n.TableName())
+	} else {
+		name = escaped(derive(table))
+	}
+	if s, ok := model.(SchemaNamer); ok {
+		schema = s.Schema()
+	}
+	return
+}
+
+// quote 转义单个标识符, 保留大小写: Billing => "Billing"
+func quote(name string) string {
+	return fmt.Sprintf("%s%s%s", escape, strings.Replace(name, escape, escape+escape, -1), escape)
+}
+
+// Schema 指定表所在的 schema, 优先于结构体的 Schema() 方法, 同一套结构体可以操作不同租户的 schema
+func (x *Curd) Schema(schema string) *Curd {
+	x.schema = schema
+	return x
+}
+
+// qualify 转义后的表名加上 schema 前缀: "billing"."invoice"
+func (x *Curd) qualify(name string, schema string) string {
+	if x.schema != "" {
+		schema = x.schema
+	}
+	if schema == "" || name == "" || strings.Index(name, fmt.Sprintf("%s.%s", escape, escape)) >= 0 {
+		// 没有 schema, 或者表名本身已经带有 schema
+		return name
+	}
+	return fmt.Sprintf("%s.%s", quote(schema), name)
+}
+
+// named 推算带 schema 前缀的转义表名
+func (x *Curd) named(table interface{}) string {
+	return x.qualify(tabled(table))
+}
+
+// from 当前操作的带 schema 前缀的转义表名
+func (x *Curd) from() string {
+	return x.qualify(x.table, x.space)
+}
@@ -0,0 +1,142 @@
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 事务遇到序列化失败(40001)或死锁(40P01)时重新执行整个事务的策略
+type RetryPolicy struct {
+	MaxAttempts int                             // 最多执行的次数, 包含第一次, 小于等于 1 时不重试
+	Backoff     func(attempt int) time.Duration // 第 attempt 次执行失败后, 重试之前等待的时长
+}
+
+// maxBackoff DefaultRetryPolicy 单次等待时长(不含抖动)的上限, 避免重试次数很大时移位溢出
+const maxBackoff = 2 * time.Second
+
+// DefaultRetryPolicy 默认最多执行 3 次, 指数退避并加入随机抖动
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff: func(attempt int) time.Duration {
+		wait := maxBackoff
+		if attempt >= 1 && attempt <= 16 {
+			if w := 20 * time.Millisecond << uint(attempt-1); w < wait {
+				wait = w
+			}
+		}
+		if wait <= 0 {
+			return 0
+		}
+		return wait + time.Duration(rand.Int63n(int64(wait)))
+	},
+}
+
+// retryPolicy 全局重试策略, 客户端没有设置时使用
+var retryPolicy = DefaultRetryPolicy
+
+// SetRetryPolicy 设置全局事务重试策略
+func SetRetryPolicy(policy RetryPolicy) {
+	retryPolicy = policy
+}
+
+// SetRetryPolicy 设置客户端事务重试策略, 优先于全局策略
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = &policy
+}
+
+// Transaction 使用默认客户端在事务中执行 fn
+func Transaction(ctx context.Context, opts *sql.TxOptions, fn func(tx *Curd) error) error {
+	return defaultClient.Transaction(ctx, opts, fn)
+}
+
+// Transaction 在事务中执行 fn, fn 返回 nil 时提交, 返回错误或者 panic 时回滚
+// 遇到序列化失败或死锁时按重试策略重新执行整个事务, fn 可能会被执行多次
+// ctx 中已经携带了该客户端开启的事务时(如 tx.Context()), 使用保存点嵌套执行
+func (c *Client) Transaction(ctx context.Context, opts *sql.TxOptions, fn func(tx *Curd) error) error {
+	if outer, ok := ctx.Value(txKey{}).(*Curd); ok && outer.tx != nil && outer.client == c {
+		return outer.Transaction(ctx, opts, fn)
+	}
+	policy := retryPolicy
+	if c.retry != nil {
+		policy = *c.retry
+	}
+	for attempt := 1; ; attempt++ {
+		err := c.transaction(ctx, opts, fn)
+		if err == nil || !retryable(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+		if policy.Backoff == nil {
+			continue
+		}
+		timer := time.NewTimer(policy.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// transaction 执行一次事务
+func (c *Client) transaction(ctx context.Context, opts *sql.TxOptions, fn func(tx *Curd) error) (err error) {
+	tx := c.BeginCtx(ctx, opts)
+	if tx.Error() != nil {
+		return tx.Error()
+	}
+	tx.ctx = context.WithValue(ctx, txKey{}, tx)
+	defer func() {
+		if p := recover(); p != nil {
+			tx.RollBack()
+			panic(p)
+		}
+	}()
+	err = fn(tx)
+	if err == nil {
+		// fn 没有检查的执行错误, 该事务已经无法提交
+		err = tx.failed
+	}
+	if err != nil {
+		tx.RollBack()
+		return err
+	}
+	tx.Commit()
+	return tx.Error()
+}
+
+// retryable 是否为可以通过重新执行事务解决的错误
+func retryable(err error) bool {
+	return IsSerializationFailure(err) || IsDeadlock(err)
+}
+
+// implicit 没有开启事务时在隐式事务中执行 fn, fn 执行之后 Error() 不为 nil 时回滚, 否则提交
+func (x *Curd) implicit(fn func()) {
+	c := x.client
+	if c == nil {
+		c = defaultClient
+	}
+	tx, err := c.DB().BeginTx(x.context(), nil)
+	if err != nil {
+		x.ri0()
+		x.error = err
+		return
+	}
+	x.tx = tx
+	defer func() {
+		x.tx = nil
+		x.failed = nil
+		x.savepoints = nil
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	fn()
+	if x.error != nil {
+		_ = tx.Rollback()
+		return
+	}
+	x.error = tx.Commit()
+}
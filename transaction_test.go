@@ -0,0 +1,147 @@
+package pg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/lib/pq"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDefaultBackoff(t *testing.T) {
+	last := time.Duration(0)
+	for _, attempt := range []int{math.MinInt32, -1, 0, 1, 2, 3, 7, 8, 16, 17, 39, 40, 63, 64, 65, 1000, math.MaxInt32} {
+		wait := DefaultRetryPolicy.Backoff(attempt)
+		if wait <= 0 || wait >= 2*maxBackoff {
+			t.Errorf("attempt %d: backoff %v out of (0, %v)", attempt, wait, 2*maxBackoff)
+		}
+		if attempt == 1 && (wait < 20*time.Millisecond || wait >= 40*time.Millisecond) {
+			t.Errorf("attempt 1: backoff %v, want 20ms + jitter", wait)
+		}
+		last = wait
+	}
+	if last < maxBackoff {
+		t.Errorf("large attempt: backoff %v, want at least %v", last, maxBackoff)
+	}
+}
+
+// testFailing 前 n 次 UPDATE 返回 code 对应的错误
+func testFailing(d *testDriver, n int, code pq.ErrorCode) {
+	d.exec = func(query string, args []driver.Value) (driver.Result, error) {
+		if query == "UPDATE" && n > 0 {
+			n--
+			return nil, &pq.Error{Code: code}
+		}
+		return driver.RowsAffected(1), nil
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	for _, code := range []pq.ErrorCode{CodeSerializationFailure, CodeDeadlockDetected} {
+		db, d := testDB(t.Name() + string(code))
+		c := NewClient(db)
+		c.SetRetryPolicy(RetryPolicy{MaxAttempts: 3})
+		testFailing(d, 2, code)
+		calls := 0
+		err := c.Transaction(context.Background(), nil, func(tx *Curd) error {
+			calls++
+			tx.Exec("UPDATE")
+			return tx.Error()
+		})
+		if err != nil || calls != 3 {
+			t.Fatalf("%s: got %v after %d calls", code, err, calls)
+		}
+		want := []string{"BEGIN", "UPDATE", "ROLLBACK", "BEGIN", "UPDATE", "ROLLBACK", "BEGIN", "UPDATE", "COMMIT"}
+		if got := d.logged(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got  %q\nwant %q", code, got, want)
+		}
+	}
+}
+
+func TestTransactionMaxAttempts(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	backoff := []int{}
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: func(attempt int) time.Duration {
+		backoff = append(backoff, attempt)
+		return 0
+	}})
+	testFailing(d, 10, CodeSerializationFailure)
+	calls := 0
+	err := c.Transaction(context.Background(), nil, func(tx *Curd) error {
+		calls++
+		tx.Exec("UPDATE")
+		return tx.Error()
+	})
+	if !IsSerializationFailure(err) || calls != 2 || !reflect.DeepEqual(backoff, []int{1}) {
+		t.Fatalf("got %v after %d calls, backoff %v", err, calls, backoff)
+	}
+
+	// 其他错误不重试
+	testFailing(d, 10, CodeUniqueViolation)
+	calls = 0
+	err = c.Transaction(context.Background(), nil, func(tx *Curd) error {
+		calls++
+		tx.Exec("UPDATE")
+		return tx.Error()
+	})
+	if Code(err) != CodeUniqueViolation || calls != 1 {
+		t.Fatalf("got %v after %d calls", err, calls)
+	}
+}
+
+func TestTransactionCommit(t *testing.T) {
+	db, d := testDB(t.Name())
+	err := NewClient(db).Transaction(context.Background(), nil, func(tx *Curd) error {
+		tx.Exec("UPDATE")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.logged(), []string{"BEGIN", "UPDATE", "COMMIT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	db, d := testDB(t.Name())
+	c := NewClient(db)
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want boom", p)
+			}
+		}()
+		_ = c.Transaction(context.Background(), nil, func(tx *Curd) error {
+			tx.Exec("UPDATE")
+			panic("boom")
+		})
+	}()
+	if got, want := d.logged(), []string{"BEGIN", "UPDATE", "ROLLBACK"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if n := db.Stats().InUse; n != 0 {
+		t.Errorf("%d connections in use", n)
+	}
+}
+
+func TestTransactionIgnoredError(t *testing.T) {
+	db, d := testDB(t.Name())
+	testFailing(d, 1, CodeUniqueViolation)
+	err := NewClient(db).Transaction(context.Background(), nil, func(tx *Curd) error {
+		tx.Exec("UPDATE")
+		// 没有检查执行错误
+		return nil
+	})
+	var pe *pq.Error
+	if !errors.As(err, &pe) || pe.Code != CodeUniqueViolation {
+		t.Fatalf("got %v", err)
+	}
+	if got, want := d.logged(), []string{"BEGIN", "UPDATE", "ROLLBACK"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}